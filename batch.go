@@ -0,0 +1,169 @@
+package search_trie
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Batch collects mutations to apply to a Trie at once. The zero value is
+// an empty batch ready to use.
+type Batch struct {
+	ops []batchOp
+}
+
+type batchOp struct {
+	op    byte
+	key   string
+	value uint64
+}
+
+// Put adds a Trie.Put to the batch.
+func (b *Batch) Put(key string, frequency uint) {
+	b.ops = append(b.ops, batchOp{op: opPut, key: key, value: uint64(frequency)})
+}
+
+// Inc adds a Trie.Inc to the batch.
+func (b *Batch) Inc(key string) {
+	b.ops = append(b.ops, batchOp{op: opInc, key: key})
+}
+
+// Add adds a Trie.Add to the batch.
+func (b *Batch) Add(key string, delta int64) {
+	b.ops = append(b.ops, batchOp{op: opAdd, key: key, value: uint64(delta)})
+}
+
+// Upsert adds a Trie.Upsert to the batch.
+func (b *Batch) Upsert(key string, delta int64) {
+	b.ops = append(b.ops, batchOp{op: opUpsert, key: key, value: uint64(delta)})
+}
+
+// Len returns the number of mutations in the batch.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Reset empties the batch so it can be reused.
+func (b *Batch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+// Apply applies the batch in order under a single lock acquisition. The
+// top-K of every affected node is recomputed once for the whole batch
+// rather than once per mutation. All mutations share the time of the call.
+func (t *Trie) Apply(b *Batch) {
+	t.lock()
+	defer t.unlock()
+
+	s := t.stamp()
+	for _, op := range b.ops {
+		t.logRecord(op.op, op.key, op.value, s.time)
+	}
+	ops := b.ops
+	if t.normalizer != nil {
+		ops = make([]batchOp, len(b.ops))
+		for i, op := range b.ops {
+			ops[i] = op
+			ops[i].key = t.normalize(op.key)
+		}
+	}
+	t.root.applyBatch(ops, s)
+	for i, op := range ops {
+		t.written(op.key, b.ops[i].key, op.op, op.value)
+	}
+}
+
+func (root *node) applyBatch(ops []batchOp, s stamp) {
+	// Update the terminals first, remembering the final rank of every key
+	// that changed
+	touched := map[string]topKHeapItem{}
+	for _, op := range ops {
+		var path []*node
+		if op.op == opPut || op.op == opUpsert {
+			path = root.insert(op.key)
+		} else if path = root.walk(op.key); path == nil {
+			continue
+		}
+		curr := path[len(path)-1]
+
+		switch op.op {
+		case opPut:
+			curr.frequency = uint(op.value)
+			curr.weight = s.set(curr.frequency)
+		case opInc:
+			if !curr.isEnd {
+				continue
+			}
+			curr.frequency = saturatingAdd(curr.frequency, 1)
+			curr.weight = s.add(curr.weight, 1)
+		case opAdd, opUpsert:
+			if !curr.isEnd && op.op == opAdd {
+				continue
+			}
+			if !curr.isEnd {
+				curr.frequency, curr.weight = 0, s.set(0)
+			}
+			curr.frequency = saturatingAdd(curr.frequency, int64(op.value))
+			curr.weight = s.add(curr.weight, int64(op.value))
+		}
+		curr.end(op.key)
+		curr.touch(op.key, s)
+		touched[op.key] = curr.item()
+	}
+
+	keys := make([]string, 0, len(touched))
+	for key := range touched {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	root.refreshTopK("", keys, touched)
+}
+
+// refreshTopK recomputes, bottom-up, the top-K of n and of its descendants
+// on the way to keys, the sorted changed keys of n's subtree. prefix is the
+// key n terminates.
+func (root *node) refreshTopK(prefix string, keys []string, touched map[string]topKHeapItem) {
+	// Sorted keys sharing a child are contiguous
+	var children []*node
+	rest := keys
+	if len(rest) > 0 && rest[0] == prefix {
+		rest = rest[1:]
+	}
+	for len(rest) > 0 {
+		r := firstRune(rest[0][len(prefix):])
+		child := root.mutableChild(r)
+		i := 1
+		for i < len(rest) && firstRune(rest[i][len(prefix):]) == r {
+			i++
+		}
+		child.refreshTopK(prefix+child.label, rest[:i], touched)
+		children = append(children, child)
+		rest = rest[i:]
+	}
+
+	// Unless a key dropped out of a full heap, the new top-K is found among
+	// the old one, the node's own entry and the new top-K of the changed
+	// children
+	h := root.topK
+	for i, item := range h.items {
+		if changed, ok := touched[item.key]; ok {
+			if changed.less(item) && h.Len() >= h.limit {
+				root.rebuildTopK()
+				return
+			}
+			h.items[i] = changed
+		}
+	}
+	heap.Init(h)
+
+	if changed, ok := touched[prefix]; ok && root.isEnd {
+		h.offer(changed)
+	}
+	for _, child := range children {
+		for _, item := range child.topK.items {
+			if _, ok := touched[item.key]; ok {
+				h.offer(item)
+			}
+		}
+	}
+}
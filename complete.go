@@ -0,0 +1,298 @@
+package search_trie
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Complete returns the top K keys containing every word of query, in any
+// order, so that "16 pro ip" finds "iphone 16 pro". All words but the last
+// must be whole words of a key and the last one the start of a word, unless
+// query ends with a space. Without WithTokenIndex only keys starting with
+// one of the words are found.
+func (t *Trie) Complete(query string) []Result {
+	r, done := t.read()
+	defer done()
+	return r.complete(query)
+}
+
+func (t *Trie) complete(query string) []Result {
+	query = t.normalize(query)
+	words := splitWords(query)
+	if len(words) == 0 {
+		return nil
+	}
+
+	// The last word is a prefix, the others must be whole words
+	last := words[len(words)-1]
+	need := map[string]int{}
+	for _, w := range words[:len(words)-1] {
+		need[w]++
+	}
+	prefix := last
+	if r, _ := utf8.DecodeLastRuneInString(query); !isWordRune(r) {
+		need[last]++
+		prefix = ""
+	}
+	m := wordMatch{need: need, prefix: prefix, have: map[string]int{}}
+
+	// Every word is looked up at the start of keys and, with the token
+	// index, at the start of later words. The keys found under each word
+	// come out best first, and those having all the words are kept.
+	var streams []*wordStream
+	looked := map[string]bool{}
+	for _, w := range words {
+		if !looked[w] {
+			looked[w] = true
+			streams = append(streams, t.wordStream(w))
+		}
+	}
+	// With the token index each word finds every match on its own
+	covers := len(t.tokenRoots()) > 0
+
+	limit := t.root.topK.limit
+	var items []topKHeapItem
+	found := map[string]bool{}
+	for active := len(streams); active > 0; {
+		for _, s := range streams {
+			if s.done {
+				continue
+			}
+			if len(items) >= limit {
+				// No key left under the word can make the top
+				if bound, ok := s.peek(); !ok || weaker(bound, items[limit-1]) {
+					s.done = true
+					active--
+					continue
+				}
+			}
+			item, ok := s.next()
+			if !ok {
+				s.done = true
+				active--
+				if covers {
+					active = 0
+					break
+				}
+				continue
+			}
+			if s.matched[item.key] || !m.match(item.key) {
+				continue
+			}
+			s.matched[item.key] = true
+			if !found[item.key] {
+				found[item.key] = true
+				items = append(items, item)
+				sortItems(items)
+			}
+			if covers && len(s.matched) == limit {
+				// The best matches of a word are the best of all
+				active = 0
+				break
+			}
+		}
+	}
+
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	out := t.toResults(items)
+	if t.highlights {
+		for i := range out {
+			t.highlight(&out[i], items[i].key, wordSpans(items[i].key, need, prefix))
+		}
+	}
+	return out
+}
+
+// wordStream yields the keys having a word that starts with a given word,
+// best first. The subtrees under the word are expanded in the order of the
+// best key of their top-K.
+type wordStream struct {
+	q       []pending
+	done    bool
+	matched map[string]bool // keys matching the query found so far
+}
+
+// pending is a subtree left to expand, bounded by the best key of its
+// top-K, or a key found to yield.
+type pending struct {
+	n     *node
+	item  topKHeapItem // the bound of the subtree, or the key
+	token bool         // n is in the token index
+	found bool         // item is a key
+}
+
+func (t *Trie) wordStream(w string) *wordStream {
+	s := &wordStream{matched: map[string]bool{}}
+	for _, root := range t.roots(w) {
+		if curr, _ := root.locate(w); curr != nil {
+			s.expand(curr, false)
+		}
+	}
+	for _, root := range t.tokenRoots() {
+		if curr, _ := root.locate(w); curr != nil {
+			s.expand(curr, true)
+		}
+	}
+	return s
+}
+
+// expand queues the subtree of n.
+func (s *wordStream) expand(n *node, token bool) {
+	if best := n.topK.best(); best != nil {
+		s.push(pending{n: n, item: *best, token: token})
+	}
+}
+
+// peek returns the bound of the next key, if any.
+func (s *wordStream) peek() (topKHeapItem, bool) {
+	if len(s.q) == 0 {
+		return topKHeapItem{}, false
+	}
+	return s.q[0].item, true
+}
+
+// next returns the next key, the token index entries mapped back to it.
+func (s *wordStream) next() (topKHeapItem, bool) {
+	for len(s.q) > 0 {
+		p := s.pop()
+		if p.found {
+			return p.item, true
+		}
+		if p.n.isEnd {
+			item := p.n.item()
+			if p.token {
+				item.key, _ = tokenKey(item.key)
+			}
+			s.push(pending{item: item, found: true})
+		}
+		for _, child := range p.n.children {
+			s.expand(child, p.token)
+		}
+	}
+	return topKHeapItem{}, false
+}
+
+// before reports whether p comes out before other. Token index entries
+// rank by their rotated keys, so ties in score and frequency are broken
+// by the keys only once both are found.
+func (p pending) before(other pending) bool {
+	if weaker(other.item, p.item) {
+		return true
+	}
+	if weaker(p.item, other.item) {
+		return false
+	}
+	if p.found != other.found {
+		return !p.found
+	}
+	return other.item.less(p.item)
+}
+
+func (s *wordStream) push(p pending) {
+	s.q = append(s.q, p)
+	for i := len(s.q) - 1; i > 0; {
+		parent := (i - 1) / 2
+		if !s.q[i].before(s.q[parent]) {
+			break
+		}
+		s.q[parent], s.q[i] = s.q[i], s.q[parent]
+		i = parent
+	}
+}
+
+func (s *wordStream) pop() pending {
+	q := s.q
+	top := q[0]
+	last := len(q) - 1
+	q[0] = q[last]
+	q = q[:last]
+	for i := 0; ; {
+		first, l, r := i, 2*i+1, 2*i+2
+		if l < len(q) && q[l].before(q[first]) {
+			first = l
+		}
+		if r < len(q) && q[r].before(q[first]) {
+			first = r
+		}
+		if first == i {
+			break
+		}
+		q[i], q[first] = q[first], q[i]
+		i = first
+	}
+	s.q = q
+	return top
+}
+
+// weaker reports whether item ranks below other by score and frequency
+// alone.
+func weaker(item, other topKHeapItem) bool {
+	if item.score != other.score {
+		return item.score < other.score
+	}
+	return item.freq < other.freq
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// splitWords returns the words of s, the runs of letters and digits.
+func splitWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !isWordRune(r)
+	})
+}
+
+// wordMatch checks keys for whole words and the start of another word,
+// reusing its counts from key to key.
+type wordMatch struct {
+	need   map[string]int
+	prefix string
+	have   map[string]int
+}
+
+// match reports whether key has the words of need, as many times each, and
+// another word starting with prefix unless prefix is empty.
+func (m *wordMatch) match(key string) bool {
+	clear(m.have)
+	other := false
+	for start, end := nextWord(key, 0); start < end; start, end = nextWord(key, end) {
+		w := key[start:end]
+		if _, ok := m.need[w]; ok {
+			m.have[w]++
+		} else if m.prefix != "" && strings.HasPrefix(w, m.prefix) {
+			other = true
+		}
+	}
+	for w, n := range m.need {
+		if m.have[w] < n {
+			return false
+		}
+		if m.have[w] > n && m.prefix != "" && strings.HasPrefix(w, m.prefix) {
+			other = true
+		}
+	}
+	return m.prefix == "" || other
+}
+
+// nextWord returns the byte offsets of the first word of key at or after
+// from, or an empty span at the end of key.
+func nextWord(key string, from int) (int, int) {
+	start := -1
+	for i, r := range key[from:] {
+		switch {
+		case isWordRune(r) && start < 0:
+			start = from + i
+		case !isWordRune(r) && start >= 0:
+			return start, from + i
+		}
+	}
+	if start < 0 {
+		return len(key), len(key)
+	}
+	return start, len(key)
+}
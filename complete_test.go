@@ -0,0 +1,258 @@
+package search_trie
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestTrie_Complete(t *testing.T) {
+	testData := map[string]uint{
+		"iphone 16":             45,
+		"iphone 16 pro":         28,
+		"iphone 16 pro max 256": 1,
+		"iphone 15 pro":         20,
+		"ipad pro 16":           12,
+		"pro 16 case":           3,
+		"телефон 16 про":        30,
+		"айфон 16 про":          28,
+	}
+
+	tests := []struct {
+		name        string
+		tokens      bool
+		query       string
+		expectedRes []string
+	}{
+		{
+			name:        "Last word is a prefix",
+			tokens:      true,
+			query:       "16 pro ip",
+			expectedRes: []string{"iphone 16 pro", "ipad pro 16", "iphone 16 pro max 256"},
+		},
+		{
+			name:        "Trailing space completes the last word",
+			tokens:      true,
+			query:       "pro 16 ",
+			expectedRes: []string{"iphone 16 pro", "ipad pro 16", "pro 16 case", "iphone 16 pro max 256"},
+		},
+		{
+			name:        "Prefix of a later word",
+			tokens:      true,
+			query:       "16 ma",
+			expectedRes: []string{"iphone 16 pro max 256"},
+		},
+		{
+			name:        "Cyrillic",
+			tokens:      true,
+			query:       "16 про",
+			expectedRes: []string{"телефон 16 про", "айфон 16 про"},
+		},
+		{
+			name:        "Words are not reused",
+			tokens:      true,
+			query:       "pro p",
+			expectedRes: nil,
+		},
+		{
+			name:        "Whole words only",
+			tokens:      true,
+			query:       "1 pro",
+			expectedRes: nil,
+		},
+		{
+			name:        "Without token index, first word only",
+			query:       "16 pro ip",
+			expectedRes: []string{"iphone 16 pro", "ipad pro 16", "iphone 16 pro max 256"},
+		},
+		{
+			name:        "Without token index, keys starting with any word",
+			query:       "ipad 16 pr",
+			expectedRes: []string{"ipad pro 16"},
+		},
+		{
+			name:        "Without token index, words in the key's order",
+			query:       "iphone 16 pr",
+			expectedRes: []string{"iphone 16 pro", "iphone 16 pro max 256"},
+		},
+		{
+			name:        "Without token index, words out of order",
+			query:       "iphone pro 16",
+			expectedRes: []string{"iphone 16 pro", "iphone 16 pro max 256"},
+		},
+		{
+			name:        "Without token index, no key starts with a word",
+			query:       "16 ca",
+			expectedRes: nil,
+		},
+		{
+			name:        "Empty query",
+			tokens:      true,
+			query:       " ",
+			expectedRes: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			if tt.tokens {
+				opts = append(opts, WithTokenIndex())
+			}
+			trie := NewTrie(5, opts...)
+			for key, freq := range testData {
+				trie.Put(key, freq)
+			}
+			expectKeyOrder(t, trie.Complete(tt.query), tt.expectedRes...)
+		})
+	}
+}
+
+func TestTrie_CompleteCrowded(t *testing.T) {
+	trie := NewTrie(3, WithTokenIndex())
+	for i := 0; i < 10000; i++ {
+		trie.Put(fmt.Sprintf("i%d", i), uint(100+i))
+	}
+	trie.Put("iphone pro", 1)
+	trie.Put("pro max", 2)
+
+	// Thousands of keys start with i and rank higher, but few have pro
+	expectKeyOrder(t, trie.Complete("pro i"), "iphone pro")
+	expectKeyOrder(t, trie.Complete("i9999"), "i9999")
+}
+
+func TestTrie_CompleteModel(t *testing.T) {
+	words := []string{"iphone", "ipad", "16", "15", "pro", "max", "про", "айфон"}
+	queries := []string{"i", "16 i", "pro ", "pro m", "16 pro ", "15 16", "про а", "max pro i"}
+	rng := rand.New(rand.NewSource(1))
+
+	tokens := NewTrie(3, WithTokenIndex())
+	plain := NewTrie(3)
+	expected := map[string]uint{}
+	for i := 0; i < 300; i++ {
+		n := 1 + rng.Intn(4)
+		key := make([]string, n)
+		for j := range key {
+			key[j] = words[rng.Intn(len(words))]
+		}
+		freq := uint(rng.Intn(100))
+		tokens.Put(strings.Join(key, " "), freq)
+		plain.Put(strings.Join(key, " "), freq)
+		expected[strings.Join(key, " ")] = freq
+	}
+
+	for _, query := range queries {
+		qw := splitWords(query)
+		need := map[string]int{}
+		for _, w := range qw[:len(qw)-1] {
+			need[w]++
+		}
+		prefix := qw[len(qw)-1]
+		if strings.HasSuffix(query, " ") {
+			need[prefix]++
+			prefix = ""
+		}
+
+		// Without the token index the first word of a key is one of the
+		// query's
+		var all, first []topKHeapItem
+		for key, freq := range expected {
+			if !hasWords(key, need, prefix) {
+				continue
+			}
+			item := topKHeapItem{key: key, freq: freq}
+			all = append(all, item)
+			if w := splitWords(key)[0]; need[w] > 0 || prefix != "" && strings.HasPrefix(w, prefix) {
+				first = append(first, item)
+			}
+		}
+
+		for _, tt := range []struct {
+			trie       *Trie
+			candidates []topKHeapItem
+		}{{tokens, all}, {plain, first}} {
+			sortItems(tt.candidates)
+			want := []string{}
+			for _, item := range tt.candidates {
+				if len(want) < 3 {
+					want = append(want, item.key)
+				}
+			}
+			expectKeyOrder(t, tt.trie.Complete(query), want...)
+		}
+	}
+}
+
+func TestWordMatch(t *testing.T) {
+	tests := []struct {
+		key    string
+		need   map[string]int
+		prefix string
+		want   bool
+	}{
+		{"iphone 16 pro", map[string]int{"16": 1}, "p", true},
+		{"iphone 16 pro", map[string]int{"16": 1}, "ip", true},
+		{"iphone 16 pro", map[string]int{"16": 1}, "m", false},
+		{"iphone 16 pro", map[string]int{"16": 2}, "", false},
+		{"pro max pro", map[string]int{"pro": 1}, "p", true},
+		{"pro max", map[string]int{"pro": 1}, "p", false},
+		{"pro max", map[string]int{"pro": 1, "max": 1}, "", true},
+		{"  iphone,16  ", map[string]int{"iphone": 1}, "1", true},
+		{"", nil, "i", false},
+	}
+
+	for _, tt := range tests {
+		m := wordMatch{need: tt.need, prefix: tt.prefix, have: map[string]int{}}
+		// Twice, as the counts are reused
+		for i := 0; i < 2; i++ {
+			if got := m.match(tt.key); got != tt.want || got != hasWords(tt.key, tt.need, tt.prefix) {
+				t.Errorf("match(%q, %v, %q) = %v, want %v", tt.key, tt.need, tt.prefix, got, tt.want)
+			}
+		}
+	}
+}
+
+func BenchmarkTrie_Complete(b *testing.B) {
+	words := []string{"iphone", "ipad", "16", "15", "pro", "max", "case", "macbook", "air", "imac"}
+	rng := rand.New(rand.NewSource(1))
+	trie := NewTrie(5, WithTokenIndex())
+	for i := 0; i < 20000; i++ {
+		key := make([]string, 1+rng.Intn(4))
+		for j := range key {
+			key[j] = words[rng.Intn(len(words))]
+		}
+		trie.Put(strings.Join(key, " "), uint(rng.Intn(1000)))
+	}
+
+	for _, query := range []string{"i", "16 i", "max air i"} {
+		b.Run(query, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = trie.Complete(query)
+			}
+		})
+	}
+}
+
+// hasWords is the reference for wordMatch.match.
+func hasWords(key string, need map[string]int, prefix string) bool {
+	have := map[string]int{}
+	for _, w := range splitWords(key) {
+		have[w]++
+	}
+	for w, n := range need {
+		if have[w] < n {
+			return false
+		}
+		have[w] -= n
+	}
+	if prefix == "" {
+		return true
+	}
+	for w, n := range have {
+		if n > 0 && strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package search_trie
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// WithCopyOnWrite makes reads lock-free. Writers copy the nodes they change
+// instead of changing them in place and publish the new version of the
+// Trie, which readers load atomically and never wait for. With a positive
+// interval, writes are published together at most once per interval, so
+// reads may miss the writes of the last interval; otherwise every write is
+// visible once it returns. Writers still take turns. It has no effect on a
+// ShardedTrie, whose shards are read under their locks.
+func WithCopyOnWrite(interval time.Duration) Option {
+	return func(o *options) {
+		o.cow, o.publish = true, interval
+	}
+}
+
+// cow is the state of a Trie created WithCopyOnWrite.
+type cow struct {
+	interval  time.Duration
+	published atomic.Pointer[Trie]
+	pending   bool // a publication is scheduled
+}
+
+// view returns the version of the Trie last published for readers, or nil
+// unless the Trie was created WithCopyOnWrite.
+func (t *Trie) view() *Trie {
+	if t.cow == nil {
+		return nil
+	}
+	return t.cow.published.Load()
+}
+
+// lock acquires the write lock and makes the roots writable.
+func (t *Trie) lock() {
+	t.mu.Lock()
+	t.root = t.root.own(t.gen)
+	if t.tokens != nil {
+		t.tokens = t.tokens.own(t.gen)
+	}
+}
+
+// unlock publishes what was written, for tries created WithCopyOnWrite,
+// and releases the write lock.
+func (t *Trie) unlock() {
+	if t.cow != nil {
+		t.publish()
+	}
+	t.mu.Unlock()
+}
+
+// publish makes the writes so far visible to readers, now or at the end of
+// the publication interval. t.mu must be held.
+func (t *Trie) publish() {
+	c := t.cow
+	if c.interval <= 0 {
+		t.publishNow()
+		return
+	}
+	if c.pending {
+		return
+	}
+	c.pending = true
+	time.AfterFunc(c.interval, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		c.pending = false
+		t.publishNow()
+	})
+}
+
+func (t *Trie) publishNow() {
+	t.cow.published.Store(t.freeze())
+}
+
+// freeze returns a read-only version of the Trie sharing its nodes, which
+// writers copy from then on instead of changing them. t.mu must be held
+// for writing.
+func (t *Trie) freeze() *Trie {
+	v := &Trie{
+		root:        t.root,
+		decay:       t.decay,
+		scorer:      t.scorer,
+		normalizer:  t.normalizer,
+		corrections: t.corrections,
+		tokens:      t.tokens,
+		highlights:  t.highlights,
+		now:         t.now,
+	}
+	t.gen++
+	return v
+}
+
+// frozen returns a version of the Trie that writers leave alone, to read
+// at length without its lock: the published one for tries created
+// WithCopyOnWrite, and one frozen now otherwise.
+func (t *Trie) frozen() *Trie {
+	if v := t.view(); v != nil {
+		return v
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.freeze()
+}
+
+// read returns the version of the Trie to read, the published one for
+// tries created WithCopyOnWrite, and the function to call once done with it.
+func (t *Trie) read() (*Trie, func()) {
+	if v := t.view(); v != nil {
+		return v, func() {}
+	}
+	t.mu.RLock()
+	return t, t.mu.RUnlock
+}
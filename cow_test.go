@@ -0,0 +1,149 @@
+package search_trie
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTrie_CopyOnWrite(t *testing.T) {
+	words := []string{"iPhone", "ipad", "16", "pro", "айфон", "Айпад", "i"}
+	opts := []Option{WithTokenIndex(), WithNormalizer(DefaultNormalizer), WithHighlights()}
+	rng := rand.New(rand.NewSource(1))
+
+	plain := NewTrie(3, opts...)
+	cow := NewTrie(3, append(opts, WithCopyOnWrite(0))...)
+	each := func(fn func(*Trie)) {
+		fn(plain)
+		fn(cow)
+	}
+
+	type version struct {
+		view *Trie
+		keys []Result
+	}
+	var versions []version
+	for i := 0; i < 500; i++ {
+		n := 1 + rng.Intn(2)
+		key := make([]string, n)
+		for j := range key {
+			key[j] = words[rng.Intn(len(words))]
+		}
+		k := strings.Join(key, " ")
+
+		switch rng.Intn(5) {
+		case 0, 1:
+			freq := uint(rng.Intn(100))
+			each(func(t *Trie) { t.Put(k, freq) })
+		case 2:
+			each(func(t *Trie) { t.Inc(k) })
+		case 3:
+			each(func(t *Trie) { t.Delete(k) })
+		case 4:
+			var b Batch
+			b.Upsert(k, int64(rng.Intn(20)-5))
+			b.Put(words[rng.Intn(len(words))], uint(rng.Intn(100)))
+			each(func(t *Trie) { t.Apply(&b) })
+		}
+
+		expectExactTopK(t, cow.view().root, "")
+		if t.Failed() {
+			t.Fatalf("operation %d", i)
+		}
+		if i%50 == 0 {
+			v := cow.view()
+			versions = append(versions, version{view: v, keys: ordered(v)})
+		}
+	}
+	expectSameResults(t, plain, cow)
+
+	// Later writes copied the nodes they changed
+	for i, v := range versions {
+		if keys := ordered(v.view); !reflect.DeepEqual(keys, v.keys) {
+			t.Errorf("version %d changed: %v, want %v", i, keys, v.keys)
+		}
+	}
+}
+
+// ordered returns the keys of the frozen Trie t in order.
+func ordered(t *Trie) []Result {
+	var out []Result
+	for r := range t.traverse(context.Background(), TraverseOptions{Ordered: true}) {
+		out = append(out, r)
+	}
+	return out
+}
+
+func TestTrie_CopyOnWriteInterval(t *testing.T) {
+	pending := NewTrie(3, WithCopyOnWrite(time.Hour))
+	pending.Put("iphone", 1)
+	if res := pending.TopK("i"); len(res) != 0 {
+		t.Errorf("TopK before publication = %v, want none", res)
+	}
+
+	trie := NewTrie(3, WithCopyOnWrite(10*time.Millisecond))
+	trie.Put("iphone", 1)
+
+	deadline := time.Now().Add(time.Second)
+	for !trie.Has("iphone") {
+		if time.Now().After(deadline) {
+			t.Fatal("write never published")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMap_CopyOnWrite(t *testing.T) {
+	m := NewMap[int](3, WithCopyOnWrite(0))
+	m.Put("iphone", 2, 16)
+	m.Put("ipad", 1, 10)
+	m.Set("ipad", 11)
+
+	expected := []Entry[int]{
+		{Result: Result{Key: "iphone", Frequency: 2, Score: 2}, Value: 16},
+		{Result: Result{Key: "ipad", Frequency: 1, Score: 1}, Value: 11},
+	}
+	if got := m.TopK("i"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("TopK = %v, want %v", got, expected)
+	}
+	if v, ok := m.Get("ipad"); !ok || v != 11 {
+		t.Errorf("Get = %v, %v, want 11, true", v, ok)
+	}
+}
+
+func TestTrie_CopyOnWriteConcurrent(t *testing.T) {
+	trie := NewTrie(3, WithCopyOnWrite(0), WithTokenIndex())
+	keys := []string{"iphone", "ipad", "iphone 16", "macbook", "айфон", "айфон 16"}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := keys[(w+i)%len(keys)]
+				if w%2 == 0 {
+					trie.Upsert(key, 1)
+					continue
+				}
+				trie.TopK(key[:1])
+				trie.Complete("16 " + key[:1])
+				for range trie.TraverseContext(context.Background(), TraverseOptions{Ordered: true}) {
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var total uint
+	for r := range trie.Traverse() {
+		total += r.Frequency
+	}
+	if total != 4*200 {
+		t.Errorf("total frequency %d, want %d", total, 4*200)
+	}
+}
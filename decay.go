@@ -0,0 +1,92 @@
+package search_trie
+
+import (
+	"math"
+	"time"
+)
+
+// WithDecay ranks keys by a popularity score that halves every halfLife
+// instead of by their raw frequency. Every write adds its weight at the
+// current time, so recent activity outweighs old activity. Frequencies are
+// still kept and returned as is.
+func WithDecay(halfLife time.Duration) Option {
+	return func(o *options) {
+		o.halfLife = halfLife
+	}
+}
+
+// decay describes the exponential decay of scores. The zero value disables
+// it.
+//
+// A key's weight is the base-2 logarithm of its decayed popularity measured
+// at the epoch. Since all popularities decay at the same rate, the order of
+// two weights never changes with time, and the heaps stay valid as they age.
+type decay struct {
+	halfLife time.Duration
+	epoch    time.Time
+}
+
+func (d decay) enabled() bool {
+	return d.halfLife > 0
+}
+
+// stamp returns the stamp of a write at t.
+func (d decay) stamp(t time.Time) stamp {
+	if !d.enabled() {
+		return stamp{}
+	}
+	return stamp{decayed: true, at: float64(t.Sub(d.epoch)) / float64(d.halfLife)}
+}
+
+// popularity returns the popularity of a key with weight, decayed until t.
+func (d decay) popularity(weight float64, t time.Time) float64 {
+	return math.Exp2(weight - d.stamp(t).at)
+}
+
+// stamp carries what a write needs to weigh and score a key. The zero value
+// is used by tries with neither decay nor a Scorer, where weights and scores
+// stay zero and ranking is by frequency.
+type stamp struct {
+	decayed bool
+	// at is the weight of one added at the time of the write.
+	at float64
+	// time is the time of the write, zero if the Trie does not track it.
+	time   time.Time
+	scorer Scorer
+}
+
+// set returns the weight of a key whose frequency is set to freq.
+func (s stamp) set(freq uint) float64 {
+	if !s.decayed {
+		return 0
+	}
+	return math.Log2(float64(freq)) + s.at
+}
+
+// add returns the weight of a key after its frequency changed by delta.
+// Weights saturate at zero, like frequencies.
+func (s stamp) add(weight float64, delta int64) float64 {
+	if !s.decayed || delta == 0 {
+		return weight
+	}
+
+	d := math.Log2(math.Abs(float64(delta))) + s.at
+	if delta > 0 {
+		return logAdd2(weight, d)
+	}
+	if d >= weight {
+		return math.Inf(-1)
+	}
+	return weight + math.Log2(-math.Expm1((d-weight)*math.Ln2))
+}
+
+// logAdd2 returns log2(2^a + 2^b) without overflowing.
+func logAdd2(a, b float64) float64 {
+	if a < b {
+		a, b = b, a
+	}
+	if math.IsInf(b, -1) {
+		return a
+	}
+	return a + math.Log1p(math.Exp2(b-a))/math.Ln2
+}
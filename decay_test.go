@@ -0,0 +1,128 @@
+package search_trie
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source for decay tests.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func expectScores(t *testing.T, res []Result, expected []Result) {
+	t.Helper()
+
+	if len(res) != len(expected) {
+		t.Fatalf("got %v, want %v", res, expected)
+	}
+	for i, item := range expected {
+		if res[i].Key != item.Key || res[i].Frequency != item.Frequency || math.Abs(res[i].Score-item.Score) > 1e-9 {
+			t.Errorf("got %v, want %v", res[i], item)
+		}
+	}
+}
+
+func TestTrie_Decay(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)}
+	trie := NewTrie(5, WithDecay(time.Hour), WithClock(clock.Now))
+
+	trie.Put("iphone 15", 1024)
+	clock.Advance(10 * time.Hour)
+	trie.Put("iphone 16", 4)
+
+	// Ten half-lives later the old hit weighs less than the new one
+	expectScores(t, trie.TopK("iphone"), []Result{
+		{Key: "iphone 16", Frequency: 4, Score: 4},
+		{Key: "iphone 15", Frequency: 1024, Score: 1},
+	})
+
+	// Writes add weight at the current time
+	trie.Inc("iphone 15")
+	trie.Add("iphone 15", 2)
+	// and equal scores fall back to the raw frequency
+	expectScores(t, trie.TopK("iphone"), []Result{
+		{Key: "iphone 15", Frequency: 1027, Score: 4},
+		{Key: "iphone 16", Frequency: 4, Score: 4},
+	})
+
+	// Scores decay while the order is kept
+	clock.Advance(2 * time.Hour)
+	expectScores(t, trie.TopK("iphone"), []Result{
+		{Key: "iphone 15", Frequency: 1027, Score: 1},
+		{Key: "iphone 16", Frequency: 4, Score: 1},
+	})
+
+	// Taking weight away saturates at zero
+	trie.Add("iphone 16", -2)
+	trie.Upsert("iphone 17", 3)
+	expectScores(t, trie.TopK("iphone"), []Result{
+		{Key: "iphone 17", Frequency: 3, Score: 3},
+		{Key: "iphone 15", Frequency: 1027, Score: 1},
+		{Key: "iphone 16", Frequency: 2, Score: 0},
+	})
+}
+
+func TestTrie_DecaySnapshot(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)}
+	trie := NewTrie(5, WithDecay(time.Hour), WithClock(clock.Now))
+	trie.Put("macbook", 64)
+	clock.Advance(3 * time.Hour)
+	trie.Put("macbook air", 4)
+
+	var buf bytes.Buffer
+	if _, err := trie.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	loaded := NewTrie(5, WithClock(clock.Now))
+	if _, err := loaded.ReadFrom(&buf); err != nil {
+		t.Fatalf("ReadFrom() error = %v", err)
+	}
+
+	expected := []Result{
+		{Key: "macbook", Frequency: 64, Score: 8},
+		{Key: "macbook air", Frequency: 4, Score: 4},
+	}
+	expectScores(t, trie.TopK("mac"), expected)
+	expectScores(t, loaded.TopK("mac"), expected)
+}
+
+func TestOpen_Decay(t *testing.T) {
+	dir := t.TempDir()
+	clock := &fakeClock{now: time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)}
+
+	trie, err := Open(dir, 5, LogOptions{}, WithDecay(time.Hour), WithClock(clock.Now))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	trie.Put("айфон", 16)
+	if err := trie.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint() error = %v", err)
+	}
+	clock.Advance(2 * time.Hour)
+	trie.Put("айпад", 2)
+	trie.Inc("айфон")
+	trie.Close()
+
+	// Replayed writes keep the time they were made at
+	clock.Advance(time.Hour)
+	trie, err = Open(dir, 5, LogOptions{}, WithClock(clock.Now))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer trie.Close()
+	expectScores(t, trie.TopK("ай"), []Result{
+		{Key: "айфон", Frequency: 17, Score: 2.5},
+		{Key: "айпад", Frequency: 2, Score: 1},
+	})
+}
@@ -0,0 +1,535 @@
+package search_trie
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot format, version 1. All integers are unsigned varints unless
+// noted otherwise.
+//
+//	magic    [4]byte "STRI"
+//	version  uvarint
+//	topK     uvarint
+//	halfLife uvarint nanoseconds, zero without decay
+//	epoch    varint Unix nanoseconds, only with decay
+//	scored   byte, 1 if keys were ranked by a Scorer and 0 otherwise
+//	keys     uvarint, number of terminal nodes
+//	root     node
+//	checksum [4]byte, little-endian CRC-32 (IEEE) of everything above
+//
+// Nodes are written in pre-order, children sorted by label:
+//
+//	label     uvarint length, then bytes
+//	flags     byte, bit 0 set for terminal nodes
+//	frequency uvarint, terminal nodes only
+//	weight    little-endian float64 bits, terminal nodes with decay only
+//	updated   varint Unix nanoseconds of the last write, zero if unknown,
+//	          terminal nodes only
+//	forms     uvarint count, then each spelling of the key as a uvarint
+//	          length, the bytes and a uvarint count, terminal nodes only
+//	topK      uvarint count, then the ordinal of each key in heap order
+//	children  uvarint count, then each child node
+//
+// A key's ordinal is the position of its terminal node among all terminal
+// nodes in pre-order, so heaps are restored as written. Scores are not
+// stored: keys are rescored on load if they were or are to be ranked by a
+// Scorer.
+const (
+	snapshotMagic   = "STRI"
+	snapshotVersion = 1
+
+	flagEnd = 1 << 0
+
+	maxSnapshotTopK = 1 << 20
+)
+
+// ErrInvalidSnapshot is returned by ReadFrom for data that is not a valid
+// snapshot. The wrapping error describes what is wrong.
+var ErrInvalidSnapshot = errors.New("search_trie: invalid snapshot")
+
+// WriteTo writes a binary snapshot of the Trie to w.
+func (t *Trie) WriteTo(w io.Writer) (int64, error) {
+	r, done := t.read()
+	defer done()
+	return r.writeTo(w)
+}
+
+// ReadFrom replaces the contents of the Trie, including its topK limit and
+// decay settings, with a snapshot read from r. On error the Trie is left
+// unchanged. Durable tries restore their snapshot in Open and cannot be
+// loaded this way. Keys are rescored by the Trie's Scorer, if any.
+func (t *Trie) ReadFrom(r io.Reader) (int64, error) {
+	if t.log != nil {
+		return 0, errors.New("search_trie: ReadFrom on a durable trie")
+	}
+
+	root, meta, n, err := readNodeSnapshot(r)
+	if err != nil {
+		return n, err
+	}
+
+	t.lock()
+	defer t.unlock()
+	t.load(root, meta)
+	return n, nil
+}
+
+// snapshotMeta holds the settings a snapshot was written with.
+type snapshotMeta struct {
+	decay  decay
+	scored bool
+}
+
+func (t *Trie) meta() snapshotMeta {
+	return snapshotMeta{decay: t.decay, scored: t.scorer != nil}
+}
+
+// load replaces the contents of the Trie with a snapshot.
+func (t *Trie) load(root *node, meta snapshotMeta) {
+	t.root, t.decay = root, meta.decay
+	if meta.scored || t.scorer != nil {
+		t.rescore()
+	}
+	t.rebuildTokens()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type encoder struct {
+	w        *bufio.Writer
+	crc      uint32
+	buf      [binary.MaxVarintLen64]byte
+	ordinals map[string]uint64
+	decayed  bool
+}
+
+func (root *node) writeTo(w io.Writer, meta snapshotMeta) (int64, error) {
+	ordinals := map[string]uint64{}
+	root.assignOrdinals("", ordinals)
+	return encode(w, meta, root.topK.limit, ordinals, func(e *encoder) error {
+		return e.writeNode(root, "")
+	})
+}
+
+// encode writes a snapshot of a tree with the given topK limit, whose keys
+// have the given ordinals, to w. writeRoot writes the root node.
+func encode(w io.Writer, meta snapshotMeta, limit int, ordinals map[string]uint64, writeRoot func(*encoder) error) (int64, error) {
+	d := meta.decay
+	cw := &countingWriter{w: w}
+	e := &encoder{w: bufio.NewWriter(cw), ordinals: ordinals, decayed: d.enabled()}
+
+	e.write([]byte(snapshotMagic))
+	e.uvarint(snapshotVersion)
+	e.uvarint(uint64(limit))
+	e.uvarint(uint64(d.halfLife))
+	if d.enabled() {
+		n := binary.PutVarint(e.buf[:], d.epoch.UnixNano())
+		e.write(e.buf[:n])
+	}
+	if meta.scored {
+		e.write([]byte{1})
+	} else {
+		e.write([]byte{0})
+	}
+	e.uvarint(uint64(len(e.ordinals)))
+	if err := writeRoot(e); err != nil {
+		return cw.n, err
+	}
+
+	binary.LittleEndian.PutUint32(e.buf[:4], e.crc)
+	e.w.Write(e.buf[:4])
+	err := e.w.Flush()
+	return cw.n, err
+}
+
+// sortedChildren returns the node's children ordered by label.
+func (root *node) sortedChildren() []*node {
+	children := make([]*node, 0, len(root.children))
+	for _, child := range root.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].label < children[j].label
+	})
+	return children
+}
+
+func (root *node) assignOrdinals(prefix string, ordinals map[string]uint64) {
+	prefix += root.label
+	if root.isEnd {
+		ordinals[prefix] = uint64(len(ordinals))
+	}
+	for _, child := range root.sortedChildren() {
+		child.assignOrdinals(prefix, ordinals)
+	}
+}
+
+func (e *encoder) write(p []byte) {
+	e.crc = crc32.Update(e.crc, crc32.IEEETable, p)
+	e.w.Write(p) // bufio.Writer keeps the first error for Flush
+}
+
+func (e *encoder) uvarint(v uint64) {
+	n := binary.PutUvarint(e.buf[:], v)
+	e.write(e.buf[:n])
+}
+
+func (e *encoder) writeNode(n *node, prefix string) error {
+	prefix += n.label
+	e.uvarint(uint64(len(n.label)))
+	e.write([]byte(n.label))
+	e.writeEnd(n)
+	if err := e.writeTopK(prefix, n.topK.items); err != nil {
+		return err
+	}
+
+	children := n.sortedChildren()
+	e.uvarint(uint64(len(children)))
+	for _, child := range children {
+		if err := e.writeNode(child, prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEnd writes the flags of a node and what it stores about the key it
+// terminates, if any. n may be nil for a node terminating no key.
+func (e *encoder) writeEnd(n *node) {
+	if n != nil && n.isEnd {
+		e.write([]byte{flagEnd})
+		e.uvarint(uint64(n.frequency))
+		if e.decayed {
+			binary.LittleEndian.PutUint64(e.buf[:8], math.Float64bits(n.weight))
+			e.write(e.buf[:8])
+		}
+		m := binary.PutVarint(e.buf[:], n.updated)
+		e.write(e.buf[:m])
+		e.uvarint(uint64(len(n.forms)))
+		for _, f := range n.forms {
+			e.uvarint(uint64(len(f.form)))
+			e.write([]byte(f.form))
+			e.uvarint(uint64(f.count))
+		}
+	} else {
+		e.write([]byte{0})
+	}
+}
+
+// writeTopK writes the top-K of the node whose key is prefix.
+func (e *encoder) writeTopK(prefix string, items []topKHeapItem) error {
+	e.uvarint(uint64(len(items)))
+	for _, item := range items {
+		ordinal, ok := e.ordinals[item.key]
+		if !ok {
+			return fmt.Errorf("search_trie: top-K of %q holds unknown key %q", prefix, item.key)
+		}
+		e.uvarint(ordinal)
+	}
+	return nil
+}
+
+type decoder struct {
+	r       *bufio.Reader
+	n       int64
+	crc     uint32
+	one     [1]byte
+	limit   int
+	decayed bool
+
+	keys  []string
+	items []topKHeapItem
+	heaps []pendingHeap
+}
+
+// pendingHeap is a top-K whose key ordinals are resolved once all
+// terminal nodes have been read.
+type pendingHeap struct {
+	heap     *topKHeap
+	ordinals []uint64
+}
+
+func readNodeSnapshot(r io.Reader) (*node, snapshotMeta, int64, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	root, meta, err := d.read()
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			err = fmt.Errorf("%w: truncated at byte %d", ErrInvalidSnapshot, d.n)
+		}
+		return nil, snapshotMeta{}, d.n, err
+	}
+	return root, meta, d.n, nil
+}
+
+func (d *decoder) corrupt(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s at byte %d", ErrInvalidSnapshot, fmt.Sprintf(format, args...), d.n)
+}
+
+func (d *decoder) ReadByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	d.n++
+	d.one[0] = b
+	d.crc = crc32.Update(d.crc, crc32.IEEETable, d.one[:])
+	return b, nil
+}
+
+func (d *decoder) readFull(p []byte) error {
+	n, err := io.ReadFull(d.r, p)
+	d.n += int64(n)
+	d.crc = crc32.Update(d.crc, crc32.IEEETable, p[:n])
+	return err
+}
+
+func (d *decoder) uvarint() (uint64, error) {
+	v, err := binary.ReadUvarint(d)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, d.corrupt("%v", err)
+	}
+	return v, err
+}
+
+// count reads a length prefix and checks it against max.
+func (d *decoder) count(what string, max uint64) (int, error) {
+	v, err := d.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if v > max {
+		return 0, d.corrupt("%s %d exceeds %d", what, v, max)
+	}
+	return int(v), nil
+}
+
+func (d *decoder) read() (*node, snapshotMeta, error) {
+	magic := make([]byte, len(snapshotMagic))
+	if err := d.readFull(magic); err != nil {
+		return nil, snapshotMeta{}, err
+	}
+	if string(magic) != snapshotMagic {
+		return nil, snapshotMeta{}, d.corrupt("bad magic %q", magic)
+	}
+
+	version, err := d.uvarint()
+	if err != nil {
+		return nil, snapshotMeta{}, err
+	}
+	if version != snapshotVersion {
+		return nil, snapshotMeta{}, d.corrupt("unsupported version %d", version)
+	}
+
+	limit, err := d.count("topK", maxSnapshotTopK)
+	if err != nil {
+		return nil, snapshotMeta{}, err
+	}
+	if limit == 0 {
+		return nil, snapshotMeta{}, d.corrupt("topK is zero")
+	}
+	d.limit = limit
+
+	var dec decay
+	halfLife, err := d.uvarint()
+	if err != nil {
+		return nil, snapshotMeta{}, err
+	}
+	if halfLife > math.MaxInt64 {
+		return nil, snapshotMeta{}, d.corrupt("half-life %d overflows", halfLife)
+	}
+	if halfLife > 0 {
+		epoch, err := binary.ReadVarint(d)
+		if err != nil {
+			return nil, snapshotMeta{}, err
+		}
+		dec = decay{halfLife: time.Duration(halfLife), epoch: time.Unix(0, epoch)}
+	}
+	d.decayed = dec.enabled()
+
+	scored, err := d.ReadByte()
+	if err != nil {
+		return nil, snapshotMeta{}, err
+	}
+	if scored > 1 {
+		return nil, snapshotMeta{}, d.corrupt("invalid scored flag %d", scored)
+	}
+	meta := snapshotMeta{decay: dec, scored: scored == 1}
+
+	keys, err := d.uvarint()
+	if err != nil {
+		return nil, snapshotMeta{}, err
+	}
+
+	root, err := d.readNode("", true)
+	if err != nil {
+		return nil, snapshotMeta{}, err
+	}
+	if uint64(len(d.items)) != keys {
+		return nil, snapshotMeta{}, d.corrupt("header promises %d keys, found %d", keys, len(d.items))
+	}
+
+	sum := d.crc
+	var trailer [4]byte
+	if err := d.readFull(trailer[:]); err != nil {
+		return nil, snapshotMeta{}, err
+	}
+	if got := binary.LittleEndian.Uint32(trailer[:]); got != sum {
+		return nil, snapshotMeta{}, d.corrupt("checksum mismatch: stored %08x, computed %08x", got, sum)
+	}
+
+	for _, p := range d.heaps {
+		items := make([]topKHeapItem, len(p.ordinals))
+		for i, ordinal := range p.ordinals {
+			items[i] = d.items[ordinal]
+		}
+		p.heap.set(items)
+	}
+	return root, meta, nil
+}
+
+func (d *decoder) readNode(prefix string, isRoot bool) (*node, error) {
+	n := newnode(d.limit)
+
+	size, err := d.count("label length", 1<<24)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 && !isRoot {
+		return nil, d.corrupt("empty label")
+	}
+	label := make([]byte, size)
+	if err := d.readFull(label); err != nil {
+		return nil, err
+	}
+	key := prefix + string(label)
+
+	flags, err := d.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if flags&^flagEnd != 0 {
+		return nil, d.corrupt("unknown flags %#x", flags)
+	}
+	// Only a terminal keeps its key, so other nodes copy their label out
+	// of it
+	n.label = key[len(prefix):]
+	if flags&flagEnd == 0 {
+		n.label = strings.Clone(n.label)
+	}
+
+	first := uint64(len(d.items))
+	if flags&flagEnd != 0 {
+		freq, err := d.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if uint64(uint(freq)) != freq {
+			return nil, d.corrupt("frequency %d overflows uint", freq)
+		}
+		n.isEnd = true
+		n.key = key
+		n.frequency = uint(freq)
+		if d.decayed {
+			var bits [8]byte
+			if err := d.readFull(bits[:]); err != nil {
+				return nil, err
+			}
+			n.weight = math.Float64frombits(binary.LittleEndian.Uint64(bits[:]))
+			if math.IsNaN(n.weight) || math.IsInf(n.weight, 1) {
+				return nil, d.corrupt("invalid weight for %q", key)
+			}
+			n.score = n.weight
+		}
+		if n.updated, err = binary.ReadVarint(d); err != nil {
+			return nil, err
+		}
+		if n.forms, err = d.readForms(); err != nil {
+			return nil, err
+		}
+		d.items = append(d.items, n.item())
+	}
+
+	heapSize, err := d.count("top-K size", uint64(d.limit))
+	if err != nil {
+		return nil, err
+	}
+	ordinals := make([]uint64, heapSize)
+	for i := range ordinals {
+		if ordinals[i], err = d.uvarint(); err != nil {
+			return nil, err
+		}
+	}
+
+	children, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < children; i++ {
+		child, err := d.readNode(key, false)
+		if err != nil {
+			return nil, err
+		}
+		r := firstRune(child.label)
+		if n.children[r] != nil {
+			return nil, d.corrupt("duplicate child %q under %q", child.label, key)
+		}
+		n.children[r] = child
+	}
+
+	// Heaps may only reference keys of their own subtree
+	last := uint64(len(d.items))
+	for _, ordinal := range ordinals {
+		if ordinal < first || ordinal >= last {
+			return nil, d.corrupt("top-K of %q references key %d outside its subtree", key, ordinal)
+		}
+	}
+	d.heaps = append(d.heaps, pendingHeap{heap: n.topK, ordinals: ordinals})
+
+	return n, nil
+}
+
+func (d *decoder) readForms() ([]surfaceForm, error) {
+	count, err := d.count("spellings", maxSurfaceForms)
+	if err != nil || count == 0 {
+		return nil, err
+	}
+
+	forms := make([]surfaceForm, count)
+	for i := range forms {
+		size, err := d.count("spelling length", 1<<24)
+		if err != nil {
+			return nil, err
+		}
+		form := make([]byte, size)
+		if err := d.readFull(form); err != nil {
+			return nil, err
+		}
+		n, err := d.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if uint64(uint(n)) != n {
+			return nil, d.corrupt("spelling count %d overflows uint", n)
+		}
+		forms[i] = surfaceForm{form: string(form), count: uint(n)}
+	}
+	return forms, nil
+}
@@ -0,0 +1,113 @@
+package search_trie
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTrie_WriteToReadFrom(t *testing.T) {
+	testData := map[string]uint{
+		"iphone":                30,
+		"iphone 16":             45,
+		"iphone 16 pro":         28,
+		"iphone 16 pro max 256": 1,
+		"ipad":                  35,
+		"айфон":                 30,
+		"айфон 16 про":          28,
+		"макбук":                4,
+	}
+
+	trie := NewTrie(3)
+	for key, freq := range testData {
+		trie.Put(key, freq)
+	}
+
+	var buf bytes.Buffer
+	n, err := trie.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo() = %d, wrote %d bytes", n, buf.Len())
+	}
+
+	loaded := NewTrie(10)
+	if _, err := loaded.ReadFrom(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("ReadFrom() error = %v", err)
+	}
+
+	if loaded.root.topK.limit != 3 {
+		t.Errorf("topK limit = %d, want 3", loaded.root.topK.limit)
+	}
+	output := make(map[string]uint)
+	for item := range loaded.Traverse() {
+		output[item.Key] = item.Frequency
+	}
+	if len(output) != len(testData) {
+		t.Errorf("Traverse() returned %d keys, want %d", len(output), len(testData))
+	}
+	for key, freq := range testData {
+		if output[key] != freq {
+			t.Errorf("key %q has frequency %d, want %d", key, output[key], freq)
+		}
+	}
+	for _, prefix := range []string{"i", "ip", "iphone 1", "ай", "м"} {
+		want, got := trie.TopK(prefix), loaded.TopK(prefix)
+		if len(want) != len(got) {
+			t.Fatalf("TopK(%q) = %v, want %v", prefix, got, want)
+		}
+		for i := range want {
+			if !reflect.DeepEqual(want[i], got[i]) {
+				t.Errorf("TopK(%q) = %v, want %v", prefix, got, want)
+			}
+		}
+	}
+}
+
+func TestTrie_ReadFromInvalid(t *testing.T) {
+	trie := NewTrie(5)
+	trie.Put("iphone", 30)
+	trie.Put("ipad", 35)
+
+	var buf bytes.Buffer
+	if _, err := trie.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	valid := buf.Bytes()
+
+	corrupt := func(i int) []byte {
+		data := append([]byte(nil), valid...)
+		data[i] ^= 0xff
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Empty", data: nil},
+		{name: "Bad magic", data: corrupt(0)},
+		{name: "Bad version", data: corrupt(4)},
+		{name: "Truncated", data: valid[:len(valid)/2]},
+		{name: "Missing checksum", data: valid[:len(valid)-2]},
+		{name: "Flipped byte", data: corrupt(len(valid) - 8)},
+		{name: "Bad checksum", data: corrupt(len(valid) - 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := NewTrie(5)
+			target.Put("macbook", 4)
+
+			_, err := target.ReadFrom(bytes.NewReader(tt.data))
+			if !errors.Is(err, ErrInvalidSnapshot) {
+				t.Fatalf("ReadFrom() error = %v, want ErrInvalidSnapshot", err)
+			}
+			if !target.Has("macbook") || target.Has("iphone") {
+				t.Errorf("ReadFrom() modified the trie on error")
+			}
+		})
+	}
+}
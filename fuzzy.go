@@ -0,0 +1,149 @@
+package search_trie
+
+import "unicode/utf8"
+
+// editPenalty divides a fuzzy candidate's frequency, or decayed weight, once
+// per edit when ranking, so close matches outrank slightly more popular
+// distant ones.
+const editPenalty = 4
+
+type fuzzyMatch struct {
+	node     *node
+	distance int
+	end      int // length in bytes of the matched prefix of the node's keys
+}
+
+// fuzzySearch walks the trie with a Levenshtein automaton for query,
+// counting insertions, deletions, substitutions and adjacent transpositions
+// as one edit each.
+type fuzzySearch struct {
+	query    []rune
+	maxEdits int
+	matches  []fuzzyMatch
+}
+
+// fuzzyState is the automaton state after reading a path from the root.
+type fuzzyState struct {
+	row     []int
+	prevRow []int
+	last    rune
+}
+
+func (f *fuzzySearch) start() fuzzyState {
+	row := make([]int, len(f.query)+1)
+	for i := range row {
+		row[i] = i
+	}
+	return fuzzyState{row: row}
+}
+
+// step feeds one path rune into the automaton.
+func (f *fuzzySearch) step(s fuzzyState, c rune) fuzzyState {
+	q := f.query
+	row := make([]int, len(q)+1)
+	row[0] = s.row[0] + 1
+	for i := 1; i <= len(q); i++ {
+		cost := 1
+		if q[i-1] == c {
+			cost = 0
+		}
+		row[i] = minInt(s.row[i]+1, row[i-1]+1, s.row[i-1]+cost)
+		if i > 1 && s.prevRow != nil && q[i-1] == s.last && q[i-2] == c {
+			row[i] = minInt(row[i], s.prevRow[i-2]+1)
+		}
+	}
+	return fuzzyState{row: row, prevRow: s.row, last: c}
+}
+
+func (s fuzzyState) distance() int {
+	return s.row[len(s.row)-1]
+}
+
+func (s fuzzyState) min() int {
+	return minInt(s.row...)
+}
+
+// walk records every node whose path prefix matches the query with fewer
+// edits than best, the distance of the closest match on the path so far.
+// depth is the length in bytes of the path to n.
+func (f *fuzzySearch) walk(n *node, s fuzzyState, best, depth int) {
+	for _, child := range n.children {
+		cs, cbest := s, best
+		label := child.label
+		for label != "" {
+			r, size := utf8.DecodeRuneInString(label)
+			label = label[size:]
+
+			cs = f.step(cs, r)
+			if d := cs.distance(); d < cbest {
+				end := depth + len(child.label) - len(label)
+				f.matches = append(f.matches, fuzzyMatch{node: child, distance: d, end: end})
+				cbest = d
+			}
+			if cs.min() > f.maxEdits || cs.min() >= cbest {
+				break
+			}
+		}
+		if label == "" && cs.min() <= f.maxEdits && cs.min() < cbest {
+			f.walk(child, cs, cbest, depth+len(child.label))
+		}
+	}
+}
+
+// getFuzzyTopK returns the top-K keys starting with a string within
+// maxEdits of prefix, along with each key's edit distance and the length in
+// bytes of its prefix matched. Candidates are ranked by distance then score
+// if scored is set, and otherwise by decayed weight if decayed is set and
+// by frequency if not, penalized per edit.
+func (root *node) getFuzzyTopK(prefix string, maxEdits int, decayed, scored bool) ([]topKHeapItem, []int, []int) {
+	f := &fuzzySearch{query: []rune(prefix), maxEdits: maxEdits}
+	s := f.start()
+	if d := s.distance(); d <= maxEdits {
+		f.matches = append(f.matches, fuzzyMatch{node: root, distance: d})
+		f.walk(root, s, d, 0)
+	} else {
+		f.walk(root, s, maxEdits+1, 0)
+	}
+
+	best := map[string]fuzzyMatch{}
+	var items []topKHeapItem
+	for _, m := range f.matches {
+		for _, item := range m.node.topK.items {
+			if item.key == "" {
+				// The empty key matches no query
+				continue
+			}
+			b, seen := best[item.key]
+			if !seen {
+				items = append(items, item)
+			}
+			if !seen || m.distance < b.distance {
+				best[item.key] = m
+			}
+		}
+	}
+
+	steps := make([]int, len(items))
+	for i, item := range items {
+		steps[i] = best[item.key].distance
+	}
+	sortPenalized(items, steps, editPenalty, decayed, scored)
+	if len(items) > root.topK.limit {
+		items, steps = items[:root.topK.limit], steps[:root.topK.limit]
+	}
+	ends := make([]int, len(items))
+	for i, item := range items {
+		ends[i] = best[item.key].end
+	}
+	return items, steps, ends
+}
+
+func minInt(v ...int) int {
+	m := v[0]
+	for _, x := range v[1:] {
+		if x < m {
+			m = x
+		}
+	}
+	return m
+}
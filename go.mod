@@ -1,3 +1,5 @@
 module github.com/zamanbekhub/search-trie
 
 go 1.21
+
+require golang.org/x/text v0.14.0
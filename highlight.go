@@ -0,0 +1,144 @@
+package search_trie
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Span is a matched segment of Result.Key, from rune Start up to but not
+// including rune End.
+type Span struct {
+	Start, End int
+}
+
+// WithHighlights makes TopK, FuzzyTopK and Complete set Result.Highlights
+// to the segments of each key the query matched.
+func WithHighlights() Option {
+	return func(o *options) {
+		o.highlights = true
+	}
+}
+
+// byteSpan is a matched segment of a normalized key, in bytes.
+type byteSpan struct {
+	start, end int
+}
+
+// highlight sets r.Highlights to the runes of r.Key the segments of key,
+// its normalized form, were normalized from.
+func (t *Trie) highlight(r *Result, key string, spans []byteSpan) {
+	if !t.highlights {
+		return
+	}
+	r.Highlights = nil
+	if r.Key == key {
+		for _, s := range spans {
+			if s.start < s.end {
+				r.Highlights = append(r.Highlights, Span{
+					Start: utf8.RuneCountInString(key[:s.start]),
+					End:   utf8.RuneCountInString(key[:s.end]),
+				})
+			}
+		}
+		return
+	}
+
+	runes := []rune(r.Key)
+	lengths := t.normalizedLengths(runes, key)
+	for _, s := range spans {
+		if s.start >= s.end {
+			continue
+		}
+		start := 0
+		for i, n := range lengths {
+			if n <= s.start {
+				start = i
+			}
+		}
+		end := len(runes)
+		for i := start; i < len(lengths); i++ {
+			if lengths[i] >= s.end {
+				end = i
+				break
+			}
+		}
+		if start < end {
+			r.Highlights = append(r.Highlights, Span{Start: start, End: end})
+		}
+	}
+}
+
+// normalizedLengths returns the length of the first i runes of the
+// display form runes once normalized, for every i. It takes each rune to
+// add what it adds after the rune before it, which holds for normalizers
+// looking no further back, and checks the total against key, the
+// normalized form. Otherwise every prefix is normalized in turn.
+func (t *Trie) normalizedLengths(runes []rune, key string) []int {
+	lengths := make([]int, len(runes)+1)
+	prev := 0 // normalized length of the rune before i
+	for i := range runes {
+		n := len(t.normalize(string(runes[i])))
+		added := n
+		if i > 0 {
+			added = len(t.normalize(string(runes[i-1:i+1]))) - prev
+		}
+		if added < 0 {
+			break
+		}
+		lengths[i+1] = lengths[i] + added
+		prev = n
+	}
+	if lengths[len(runes)] == len(key) {
+		return lengths
+	}
+
+	for i := 1; i <= len(runes); i++ {
+		lengths[i] = len(t.normalize(string(runes[:i])))
+	}
+	return lengths
+}
+
+// wordSpans returns the spans of the words of key making up need and of a
+// further word starting with prefix unless prefix is empty, in order.
+func wordSpans(key string, need map[string]int, prefix string) []byteSpan {
+	type word struct {
+		text string
+		span byteSpan
+	}
+	var words []word
+	start := -1
+	for i, r := range key + " " {
+		switch {
+		case isWordRune(r) && start < 0:
+			start = i
+		case !isWordRune(r) && start >= 0:
+			words = append(words, word{key[start:i], byteSpan{start, i}})
+			start = -1
+		}
+	}
+
+	used := make([]bool, len(words))
+	var spans []byteSpan
+	for w, n := range need {
+		for i := range words {
+			if n > 0 && !used[i] && words[i].text == w {
+				used[i] = true
+				spans = append(spans, words[i].span)
+				n--
+			}
+		}
+	}
+	if prefix != "" {
+		for i := range words {
+			if !used[i] && strings.HasPrefix(words[i].text, prefix) {
+				spans = append(spans, byteSpan{words[i].span.start, words[i].span.start + len(prefix)})
+				break
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+	return spans
+}
@@ -0,0 +1,112 @@
+package search_trie
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTrie_Highlights(t *testing.T) {
+	trie := NewTrie(5, WithHighlights(), WithTokenIndex(), WithNormalizer(DefaultNormalizer),
+		WithCorrections(Corrections{Layout: true}))
+	trie.Put("iPhone 16 Pro", 50)
+	trie.Put("Чехол для iPhone", 20)
+	trie.Put("Ёлка", 10)
+	trie.Put("Café  Crème", 5)
+
+	tests := []struct {
+		name     string
+		query    func() []Result
+		expected map[string][]Span
+	}{
+		{
+			name:  "Prefix in another case",
+			query: func() []Result { return trie.TopK("IPH") },
+			expected: map[string][]Span{
+				"iPhone 16 Pro":    {{0, 3}},
+				"Чехол для iPhone": {{10, 13}},
+			},
+		},
+		{
+			name:     "Prefix normalized from several runes",
+			query:    func() []Result { return trie.TopK("ел") },
+			expected: map[string][]Span{"Ёлка": {{0, 2}}},
+		},
+		{
+			name:     "Prefix across collapsed spaces",
+			query:    func() []Result { return trie.TopK("cafe c") },
+			expected: map[string][]Span{"Café  Crème": {{0, 7}}},
+		},
+		{
+			name:     "Correction",
+			query:    func() []Result { return trie.TopK("xt[") },
+			expected: map[string][]Span{"Чехол для iPhone": {{0, 3}}},
+		},
+		{
+			name:     "Fuzzy",
+			query:    func() []Result { return trie.FuzzyTopK("ipjone", 1) },
+			expected: map[string][]Span{"iPhone 16 Pro": {{0, 6}}},
+		},
+		{
+			name:     "Words in any order",
+			query:    func() []Result { return trie.Complete("pro 16 iph") },
+			expected: map[string][]Span{"iPhone 16 Pro": {{0, 3}, {7, 9}, {10, 13}}},
+		},
+		{
+			name:  "Page",
+			query: func() []Result { return trie.TopKPage("i", 0, 1) },
+			expected: map[string][]Span{
+				"iPhone 16 Pro": {{0, 1}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string][]Span{}
+			for _, r := range tt.query() {
+				got[r.Key] = r.Highlights
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	plain := NewTrie(5)
+	plain.Put("iphone", 1)
+	if res := plain.TopK("ip"); res[0].Highlights != nil {
+		t.Errorf("Highlights = %v without WithHighlights", res[0].Highlights)
+	}
+}
+
+func TestTrie_NormalizedLengths(t *testing.T) {
+	// Drops a rune repeating the one two runes before, looking further
+	// back than a rune
+	skip := NormalizerFunc(func(s string) string {
+		runes := []rune(s)
+		var out []rune
+		for i, r := range runes {
+			if i < 2 || runes[i-2] != r {
+				out = append(out, r)
+			}
+		}
+		return string(out)
+	})
+
+	for _, n := range []Normalizer{DefaultNormalizer, skip} {
+		trie := NewTrie(5, WithNormalizer(n))
+		for _, display := range []string{
+			"iPhone 16 Pro", "  Café  Crème ", "café", "é̂x", "Ёлка",
+			"ＩＰＨＯＮＥ", "Straße", "abab", "",
+		} {
+			runes := []rune(display)
+			expected := make([]int, len(runes)+1)
+			for i := range expected {
+				expected[i] = len(n.Normalize(string(runes[:i])))
+			}
+			if got := trie.normalizedLengths(runes, n.Normalize(display)); !reflect.DeepEqual(got, expected) {
+				t.Errorf("normalizedLengths(%q) = %v, want %v", display, got, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package search_trie
+
+import (
+	"slices"
+	"time"
+)
+
+// IterOptions bound and order an Iterator.
+type IterOptions struct {
+	// Prefix restricts iteration to keys starting with it.
+	Prefix string
+	// From is the inclusive lower bound, or "" for none.
+	From string
+	// To is the exclusive upper bound, or "" for none.
+	To string
+	// Reverse iterates from the greatest key down.
+	Reverse bool
+}
+
+// Iterator walks keys of the Trie in lexicographic order, as of the time it
+// was created. Keys are read as Next moves to them, from a version of the
+// Trie frozen when the Iterator was created. Call Next before reading the
+// first Result:
+//
+//	it := trie.Range("iphone", "iphonf")
+//	for it.Next() {
+//		fmt.Println(it.Result().Key)
+//	}
+type Iterator struct {
+	t    *Trie       // frozen
+	opts IterOptions // normalized
+	next func() *node
+	now  time.Time
+	curr *node
+}
+
+// Iter returns an Iterator over the keys matching opts. For tries created
+// WithNormalizer, bounds apply to and keys are ordered by normalized keys.
+func (t *Trie) Iter(opts IterOptions) *Iterator {
+	return t.frozen().iter(opts)
+}
+
+// iter returns an Iterator over the frozen Trie t.
+func (t *Trie) iter(opts IterOptions) *Iterator {
+	opts.Prefix = t.normalize(opts.Prefix)
+	opts.From, opts.To = t.normalize(opts.From), t.normalize(opts.To)
+	return &Iterator{t: t, opts: opts, next: t.keys(opts, true), now: t.queryTime()}
+}
+
+// Range returns an Iterator over the keys in [from, to). An empty to means
+// no upper bound.
+func (t *Trie) Range(from, to string) *Iterator {
+	return t.Iter(IterOptions{From: from, To: to})
+}
+
+// Seek positions the iterator so that the following Next moves to the first
+// key not less than key, or not greater than key when iterating in reverse.
+func (it *Iterator) Seek(key string) {
+	key = it.t.normalize(key)
+	opts := it.opts
+	if opts.Reverse {
+		// The least key greater than key bounds the keys up to it
+		if to := key + "\x00"; opts.To == "" || to < opts.To {
+			opts.To = to
+		}
+	} else if key > opts.From {
+		opts.From = key
+	}
+	it.next = it.t.keys(opts, true)
+	it.curr = nil
+}
+
+// Next moves to the next key and reports whether there is one.
+func (it *Iterator) Next() bool {
+	it.curr = it.next()
+	return it.curr != nil
+}
+
+// Result returns the key the iterator is positioned at. It panics unless
+// the last call to Next returned true.
+func (it *Iterator) Result() Result {
+	if it.curr == nil {
+		panic("search_trie: Result called without a successful Next")
+	}
+	return it.t.toResult(it.curr.item(), it.now)
+}
+
+// cursor walks the terminals of a subtree one at a time, skipping keys out
+// of [lo, hi), in lexicographic order of their keys if ordered is set, in
+// reverse if reverse is set as well. It keeps the children left to visit on
+// the way down, so its memory depends on the depth of the tree rather than
+// on the number of keys.
+type cursor struct {
+	ordered bool
+	reverse bool
+	lo, hi  string // hi is exclusive, and "" for none
+	path    []byte // key of the node visited last
+	stack   []cursorFrame
+}
+
+// cursorFrame holds the children of a node left to visit.
+type cursorFrame struct {
+	children []*node
+	depth    int   // length of the key of the node
+	end      *node // the node, returned after its children in reverse
+}
+
+// newCursor returns a cursor over the subtree of n, whose key is key.
+func newCursor(n *node, key string, opts IterOptions, ordered bool) *cursor {
+	parent := key[:len(key)-len(n.label)]
+	return &cursor{
+		ordered: ordered,
+		reverse: ordered && opts.Reverse,
+		lo:      opts.From,
+		hi:      opts.To,
+		path:    []byte(parent),
+		stack:   []cursorFrame{{children: []*node{n}, depth: len(parent)}},
+	}
+}
+
+// next returns the next terminal, or nil once there are none left.
+func (c *cursor) next() *node {
+	for len(c.stack) > 0 {
+		top := &c.stack[len(c.stack)-1]
+		if len(top.children) == 0 {
+			end := top.end
+			c.stack = c.stack[:len(c.stack)-1]
+			if end != nil {
+				return end
+			}
+			continue
+		}
+		n := top.children[0]
+		top.children = top.children[1:]
+		c.path = append(c.path[:top.depth], n.label...)
+		if !c.overlaps() {
+			continue
+		}
+
+		f := cursorFrame{children: c.children(n), depth: len(c.path)}
+		found := n.isEnd && n.key != "" && n.key >= c.lo && (c.hi == "" || n.key < c.hi)
+		if found && c.reverse {
+			f.end = n
+		}
+		c.stack = append(c.stack, f)
+		if found && !c.reverse {
+			return n
+		}
+	}
+	return nil
+}
+
+// overlaps reports whether keys starting with the path may be in bounds.
+func (c *cursor) overlaps() bool {
+	if c.hi != "" && string(c.path) >= c.hi {
+		return false
+	}
+	if string(c.path) < c.lo {
+		// Only keys on the way to lo may reach it
+		return len(c.path) <= len(c.lo) && c.lo[:len(c.path)] == string(c.path)
+	}
+	return true
+}
+
+func (c *cursor) children(n *node) []*node {
+	if c.ordered {
+		children := n.sortedChildren()
+		if c.reverse {
+			slices.Reverse(children)
+		}
+		return children
+	}
+	children := make([]*node, 0, len(n.children))
+	for _, child := range n.children {
+		children = append(children, child)
+	}
+	return children
+}
+
+// keys returns a function that returns the next terminal of the Trie
+// matching opts on every call, in lexicographic order if ordered is set,
+// and nil once there are none left. The bounds and prefix of opts must be
+// normalized. The Trie must not change meanwhile.
+func (t *Trie) keys(opts IterOptions, ordered bool) func() *node {
+	var cursors []*cursor
+	for _, root := range t.roots(opts.Prefix) {
+		if curr, key := root.locate(opts.Prefix); curr != nil {
+			cursors = append(cursors, newCursor(curr, key, opts, ordered))
+		}
+	}
+	return merge(cursors, ordered && opts.Reverse)
+}
+
+// merge returns a function returning the terminals of all cursors, merged
+// in lexicographic order, or in reverse, if the cursors are ordered.
+func merge(cursors []*cursor, reverse bool) func() *node {
+	heads := make([]*node, len(cursors))
+	for i, c := range cursors {
+		heads[i] = c.next()
+	}
+	return func() *node {
+		best := -1
+		for i, n := range heads {
+			switch {
+			case n == nil:
+			case best < 0:
+				best = i
+			case cursors[i].ordered && (n.key < heads[best].key) != reverse:
+				best = i
+			}
+		}
+		if best < 0 {
+			return nil
+		}
+		n := heads[best]
+		heads[best] = cursors[best].next()
+		return n
+	}
+}
@@ -0,0 +1,193 @@
+package search_trie
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTrie_Iter(t *testing.T) {
+	testData := map[string]uint{
+		"ipad":          10,
+		"iphone":        5,
+		"iphone 16":     3,
+		"iphone 16 pro": 7,
+		"iphone 17":     2,
+		"macbook":       4,
+		"айпад":         2,
+		"айфон":         1,
+	}
+
+	tests := []struct {
+		name        string
+		opts        IterOptions
+		seek        string
+		expectedRes []string
+	}{
+		{
+			name:        "All keys",
+			opts:        IterOptions{},
+			expectedRes: []string{"ipad", "iphone", "iphone 16", "iphone 16 pro", "iphone 17", "macbook", "айпад", "айфон"},
+		},
+		{
+			name:        "Range",
+			opts:        IterOptions{From: "iphone 1", To: "iphone 17"},
+			expectedRes: []string{"iphone 16", "iphone 16 pro"},
+		},
+		{
+			name:        "Open upper bound",
+			opts:        IterOptions{From: "m"},
+			expectedRes: []string{"macbook", "айпад", "айфон"},
+		},
+		{
+			name:        "Prefix",
+			opts:        IterOptions{Prefix: "iphone"},
+			expectedRes: []string{"iphone", "iphone 16", "iphone 16 pro", "iphone 17"},
+		},
+		{
+			name:        "Prefix and seek",
+			opts:        IterOptions{Prefix: "iphone"},
+			seek:        "iphone 16 a",
+			expectedRes: []string{"iphone 16 pro", "iphone 17"},
+		},
+		{
+			name:        "Reverse",
+			opts:        IterOptions{Prefix: "iphone", Reverse: true},
+			expectedRes: []string{"iphone 17", "iphone 16 pro", "iphone 16", "iphone"},
+		},
+		{
+			name:        "Reverse range and seek",
+			opts:        IterOptions{From: "ipad", To: "macbook", Reverse: true},
+			seek:        "iphone 16 a",
+			expectedRes: []string{"iphone 16", "iphone", "ipad"},
+		},
+		{
+			name:        "Empty range",
+			opts:        IterOptions{From: "x", To: "y"},
+			expectedRes: []string{},
+		},
+	}
+
+	trie := NewTrie(5)
+	for key, freq := range testData {
+		trie.Put(key, freq)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := trie.Iter(tt.opts)
+			if tt.seek != "" {
+				it.Seek(tt.seek)
+			}
+
+			keys := []string{}
+			for it.Next() {
+				item := it.Result()
+				if item.Frequency != testData[item.Key] {
+					t.Errorf("key %q has frequency %d, want %d", item.Key, item.Frequency, testData[item.Key])
+				}
+				keys = append(keys, item.Key)
+			}
+			if fmt.Sprint(keys) != fmt.Sprint(tt.expectedRes) {
+				t.Errorf("Iter() = %v, want %v", keys, tt.expectedRes)
+			}
+		})
+	}
+}
+
+func TestTrie_Range(t *testing.T) {
+	trie := NewTrie(5)
+	for _, key := range []string{"a", "ab", "abc", "b", "ba"} {
+		trie.Put(key, 1)
+	}
+
+	it := trie.Range("ab", "b")
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Result().Key)
+	}
+	if fmt.Sprint(keys) != "[ab abc]" {
+		t.Errorf("Range() = %v, want [ab abc]", keys)
+	}
+
+	// Seeking back rewinds the iterator
+	it.Seek("")
+	if !it.Next() || it.Result().Key != "ab" {
+		t.Errorf("Seek() did not rewind the iterator")
+	}
+}
+
+func TestTrie_IterModel(t *testing.T) {
+	// Keys sharing long prefixes, so that bounds fall inside edges
+	var keys []string
+	for _, a := range []string{"a", "ab", "aba", "abab", "b", "ба"} {
+		for _, b := range []string{"", "a", "b", "ab", "бб"} {
+			keys = append(keys, a+b)
+		}
+	}
+	trie := NewTrie(3)
+	for _, key := range keys {
+		trie.Put(key, 1)
+	}
+	sort.Strings(keys)
+	keys = slices.Compact(keys)
+
+	bounds := append([]string{"", "aa", "abb", "б"}, keys...)
+	prefixes := []string{"", "a", "aba", "б"}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		opts := IterOptions{
+			Prefix:  prefixes[rng.Intn(len(prefixes))],
+			From:    bounds[rng.Intn(len(bounds))],
+			To:      bounds[rng.Intn(len(bounds))],
+			Reverse: rng.Intn(2) == 0,
+		}
+		seek := bounds[rng.Intn(len(bounds))]
+
+		var want []string
+		for _, key := range keys {
+			if strings.HasPrefix(key, opts.Prefix) && key >= opts.From && (opts.To == "" || key < opts.To) &&
+				(seek == "" || (key >= seek) != opts.Reverse || key == seek) {
+				want = append(want, key)
+			}
+		}
+		if opts.Reverse {
+			slices.Reverse(want)
+		}
+
+		it := trie.Iter(opts)
+		if seek != "" {
+			it.Seek(seek)
+		}
+		var got []string
+		for it.Next() {
+			got = append(got, it.Result().Key)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("Iter(%+v) after Seek(%q) = %v, want %v", opts, seek, got, want)
+		}
+	}
+}
+
+func TestTrie_IterFrozen(t *testing.T) {
+	trie := NewTrie(3)
+	for _, key := range []string{"a", "b", "c"} {
+		trie.Put(key, 1)
+	}
+
+	it := trie.Range("", "")
+	it.Next()
+	trie.Delete("b")
+	trie.Put("bb", 1)
+
+	keys := []string{it.Result().Key}
+	for it.Next() {
+		keys = append(keys, it.Result().Key)
+	}
+	if fmt.Sprint(keys) != "[a b c]" {
+		t.Errorf("Range() = %v, want [a b c]", keys)
+	}
+}
@@ -0,0 +1,188 @@
+package search_trie
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Corrections configures TopK to also look up a prefix as if it was typed
+// in the other keyboard layout or transliterated, so that "fqajy" and
+// "aifon" find "айфон".
+type Corrections struct {
+	// Layout re-maps the prefix between the QWERTY and ЙЦУКЕН layouts.
+	Layout bool
+	// Translit transliterates the prefix between Latin and Cyrillic.
+	Translit bool
+	// MinResults is the number of completions below which corrections are
+	// looked up. Zero means the topK limit.
+	MinResults int
+	// Penalty lowers the rank of corrected completions as if their
+	// frequency was divided by it. Zero means 4, the cost of one edit in
+	// FuzzyTopK.
+	Penalty float64
+}
+
+func (c Corrections) enabled() bool {
+	return c.Layout || c.Translit
+}
+
+// WithCorrections enables corrections of TopK prefixes as set by c.
+func WithCorrections(c Corrections) Option {
+	return func(o *options) {
+		o.corrections = c
+	}
+}
+
+// Keys of the Russian ЙЦУКЕН layout, in the order of the QWERTY keys they
+// share.
+const (
+	qwertyKeys = "`qwertyuiop[]asdfghjkl;'zxcvbnm,.~QWERTYUIOP{}ASDFGHJKL:\"ZXCVBNM<>"
+	jcukenKeys = "ёйцукенгшщзхъфывапролджэячсмитьбюЁЙЦУКЕНГШЩЗХЪФЫВАПРОЛДЖЭЯЧСМИТЬБЮ"
+)
+
+var toJcuken, toQwerty = layoutMaps(qwertyKeys, jcukenKeys)
+
+func layoutMaps(from, to string) (map[rune]rune, map[rune]rune) {
+	fwd, back := map[rune]rune{}, map[rune]rune{}
+	for _, r := range from {
+		t, size := utf8.DecodeRuneInString(to)
+		to = to[size:]
+		fwd[r], back[t] = t, r
+	}
+	return fwd, back
+}
+
+// remap returns s with every rune found in layout replaced.
+func remap(s string, layout map[rune]rune) string {
+	return strings.Map(func(r rune) rune {
+		if m, ok := layout[r]; ok {
+			return m
+		}
+		return r
+	}, s)
+}
+
+// Latin to Cyrillic transliteration. Longer sequences are tried first.
+var translitCyrillic = []struct{ from, to string }{
+	{"shch", "щ"}, {"sch", "щ"},
+	{"sh", "ш"}, {"ch", "ч"}, {"zh", "ж"}, {"kh", "х"}, {"ts", "ц"}, {"ph", "ф"},
+	{"yo", "ё"}, {"yu", "ю"}, {"ya", "я"}, {"ye", "е"},
+	{"a", "а"}, {"b", "б"}, {"c", "к"}, {"d", "д"}, {"e", "е"}, {"f", "ф"},
+	{"g", "г"}, {"h", "х"}, {"i", "и"}, {"j", "й"}, {"k", "к"}, {"l", "л"},
+	{"m", "м"}, {"n", "н"}, {"o", "о"}, {"p", "п"}, {"q", "к"}, {"r", "р"},
+	{"s", "с"}, {"t", "т"}, {"u", "у"}, {"v", "в"}, {"w", "в"}, {"x", "кс"},
+	{"y", "ы"}, {"z", "з"},
+}
+
+var translitLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// toCyrillic transliterates the lowercase Latin letters of s. An i or y
+// after a vowel becomes й, as in "aifon".
+func toCyrillic(s string) string {
+	var b strings.Builder
+	vowel := false
+	for rest := s; rest != ""; {
+		from, to := translitNext(rest, vowel)
+		b.WriteString(to)
+		rest = rest[len(from):]
+		vowel = to != "й" && strings.ContainsAny(from[len(from)-1:], "aeiouy")
+	}
+	return b.String()
+}
+
+// translitNext returns the longest Latin sequence s starts with and its
+// Cyrillic transliteration, or the first rune of s unchanged.
+func translitNext(s string, afterVowel bool) (string, string) {
+	iotated := len(s) > 1 && strings.IndexByte("aeou", s[1]) >= 0
+	if afterVowel && (s[0] == 'i' || s[0] == 'y' && !iotated) {
+		return s[:1], "й"
+	}
+	for _, t := range translitCyrillic {
+		if strings.HasPrefix(s, t.from) {
+			return t.from, t.to
+		}
+	}
+	_, size := utf8.DecodeRuneInString(s)
+	return s[:size], s[:size]
+}
+
+// toLatin transliterates the lowercase Cyrillic letters of s.
+func toLatin(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if t, ok := translitLatin[r]; ok {
+			b.WriteString(t)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// variants returns the corrections of prefix enabled by c.
+func (c Corrections) variants(prefix string) []string {
+	var out []string
+	if c.Layout {
+		out = append(out, remap(prefix, toJcuken), remap(prefix, toQwerty))
+	}
+	if c.Translit {
+		out = append(out, toCyrillic(prefix), toLatin(prefix))
+	}
+	return out
+}
+
+// correct merges the completions of the corrections of prefix into items,
+// the sorted completions of prefix itself, if those are too few. It returns
+// the merged items along with the correction each was found by, or nil if
+// nothing was corrected.
+func (t *Trie) correct(prefix string, items []topKHeapItem) ([]topKHeapItem, []string) {
+	c, limit := t.corrections, t.root.topK.limit
+	min := c.MinResults
+	if min <= 0 {
+		min = limit
+	}
+	if !c.enabled() || len(items) >= min {
+		return items, nil
+	}
+	penalty := c.Penalty
+	if penalty <= 0 {
+		penalty = editPenalty
+	}
+
+	seen := map[string]bool{}
+	for _, item := range items {
+		seen[item.key] = true
+	}
+	steps := make([]int, len(items))
+	corrections := map[string]string{}
+	for _, v := range c.variants(prefix) {
+		v = t.normalize(v)
+		if v == "" || v == prefix {
+			continue
+		}
+		for _, item := range t.getTopK(v) {
+			if !seen[item.key] {
+				seen[item.key] = true
+				items = append(items, item)
+				steps = append(steps, 1)
+				corrections[item.key] = v
+			}
+		}
+	}
+
+	sortPenalized(items, steps, penalty, t.decay.enabled(), t.scorer != nil)
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	out := make([]string, len(items))
+	for i, item := range items {
+		out[i] = corrections[item.key]
+	}
+	return items, out
+}
@@ -0,0 +1,124 @@
+package search_trie
+
+import "testing"
+
+func TestCorrections_Variants(t *testing.T) {
+	tests := []struct {
+		name     string
+		convert  func(string) string
+		input    string
+		expected string
+	}{
+		{"QWERTY to ЙЦУКЕН", func(s string) string { return remap(s, toJcuken) }, "fqajy", "айфон"},
+		{"QWERTY to ЙЦУКЕН with punctuation keys", func(s string) string { return remap(s, toJcuken) }, ";tcnrbq lbcr", "жесткий диск"},
+		{"ЙЦУКЕН to QWERTY", func(s string) string { return remap(s, toQwerty) }, "шзфв 16", "ipad 16"},
+		{"Latin to Cyrillic", toCyrillic, "aifon", "айфон"},
+		{"Latin to Cyrillic digraphs", toCyrillic, "shchi i borshch", "щи и борщ"},
+		{"Latin to Cyrillic iotated", toCyrillic, "maya", "мая"},
+		{"Cyrillic to Latin", toLatin, "самсунг галакси", "samsung galaksi"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.convert(tt.input); got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTrie_Corrections(t *testing.T) {
+	testData := map[string]uint{
+		"iphone":       30,
+		"iphone 16":    45,
+		"ipad":         35,
+		"samsung":      20,
+		"айфон":        30,
+		"айфон 16 про": 28,
+		"aifon case":   1,
+	}
+	newTrie := func(c Corrections) *Trie {
+		trie := NewTrie(3, WithCorrections(c), WithNormalizer(FoldCase))
+		for key, freq := range testData {
+			trie.Put(key, freq)
+		}
+		return trie
+	}
+
+	tests := []struct {
+		name        string
+		corrections Corrections
+		prefix      string
+		expectedRes []Result
+	}{
+		{
+			name:        "Wrong layout, Latin typed",
+			corrections: Corrections{Layout: true},
+			prefix:      "Fqa",
+			expectedRes: []Result{
+				{Key: "айфон", Frequency: 30, Correction: "айф"},
+				{Key: "айфон 16 про", Frequency: 28, Correction: "айф"},
+			},
+		},
+		{
+			name:        "Wrong layout, Cyrillic typed",
+			corrections: Corrections{Layout: true},
+			prefix:      "шзр",
+			expectedRes: []Result{
+				{Key: "iphone 16", Frequency: 45, Correction: "iph"},
+				{Key: "iphone", Frequency: 30, Correction: "iph"},
+			},
+		},
+		{
+			name:        "Transliterated, merged below direct completions",
+			corrections: Corrections{Translit: true, Penalty: 64},
+			prefix:      "aif",
+			expectedRes: []Result{
+				{Key: "aifon case", Frequency: 1},
+				{Key: "айфон", Frequency: 30, Correction: "айф"},
+				{Key: "айфон 16 про", Frequency: 28, Correction: "айф"},
+			},
+		},
+		{
+			name:        "Transliterated, outranking direct completions",
+			corrections: Corrections{Translit: true},
+			prefix:      "aif",
+			expectedRes: []Result{
+				{Key: "айфон", Frequency: 30, Correction: "айф"},
+				{Key: "айфон 16 про", Frequency: 28, Correction: "айф"},
+				{Key: "aifon case", Frequency: 1},
+			},
+		},
+		{
+			name:        "Enough direct completions",
+			corrections: Corrections{Translit: true, MinResults: 1},
+			prefix:      "aif",
+			expectedRes: []Result{{Key: "aifon case", Frequency: 1}},
+		},
+		{
+			name:        "Cyrillic transliterated",
+			corrections: Corrections{Translit: true},
+			prefix:      "самс",
+			expectedRes: []Result{{Key: "samsung", Frequency: 20, Correction: "sams"}},
+		},
+		{
+			name:        "Disabled",
+			corrections: Corrections{},
+			prefix:      "fqa",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := newTrie(tt.corrections).TopK(tt.prefix)
+			if len(res) != len(tt.expectedRes) {
+				t.Fatalf("got %v, want %v", res, tt.expectedRes)
+			}
+			for i, item := range tt.expectedRes {
+				if res[i].Key != item.Key || res[i].Frequency != item.Frequency || res[i].Correction != item.Correction {
+					t.Errorf("got %v, want %v", res[i], item)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package search_trie
+
+import (
+	"context"
+	"time"
+)
+
+// Map is a Trie that stores a value of type V with every key and returns it
+// along with the key's rank, so results need no lookup on the side. A Scorer
+// sees the value as Signals.Payload. Values are kept in memory only.
+type Map[V any] struct {
+	t *Trie
+}
+
+// Entry is a Result together with the value of its key.
+type Entry[V any] struct {
+	Result
+	Value V
+}
+
+// NewMap creates a new Map with the given topK limit.
+func NewMap[V any](topK int, opts ...Option) *Map[V] {
+	return &Map[V]{t: NewTrie(topK, opts...)}
+}
+
+// Put inserts the given key/frequency pair into the Map and sets the value
+// of the key.
+func (m *Map[V]) Put(key string, frequency uint, value V) {
+	t := m.t
+	t.lock()
+	defer t.unlock()
+
+	form := key
+	key = t.normalize(key)
+	t.root.put(key, frequency, &payload{value: value}, t.stamp())
+	t.written(key, form, opPut, uint64(frequency))
+}
+
+// Set replaces the value of an existing key, keeping its frequency. It
+// reports false and does nothing if the key is missing.
+func (m *Map[V]) Set(key string, value V) bool {
+	m.t.lock()
+	defer m.t.unlock()
+	return m.t.setPayload(key, value)
+}
+
+// Get returns the value of key and whether the key is present.
+func (m *Map[V]) Get(key string) (V, bool) {
+	t, done := m.t.read()
+	defer done()
+
+	key = t.normalize(key)
+	n, full := t.root.locate(key)
+	if n == nil || full != key || !n.isEnd {
+		var zero V
+		return zero, false
+	}
+	v, _ := n.payload.get().(V)
+	return v, true
+}
+
+// Has checks the Map has the key.
+func (m *Map[V]) Has(key string) bool {
+	return m.t.Has(key)
+}
+
+// Inc increments the frequency of the given key. Missing keys are ignored.
+func (m *Map[V]) Inc(key string) {
+	m.t.Inc(key)
+}
+
+// Add changes the frequency of an existing key by delta, like Trie.Add.
+func (m *Map[V]) Add(key string, delta int64) (uint, bool) {
+	return m.t.Add(key, delta)
+}
+
+// Upsert is like Trie.Upsert. Keys it creates have the zero value.
+func (m *Map[V]) Upsert(key string, delta int64) (uint, bool) {
+	return m.t.Upsert(key, delta)
+}
+
+// Delete removes the key and its value and reports whether it was present.
+func (m *Map[V]) Delete(key string) bool {
+	return m.t.Delete(key)
+}
+
+// TopK is like Trie.TopK and returns the values of the keys as well.
+func (m *Map[V]) TopK(key string) []Entry[V] {
+	t, done := m.t.read()
+	defer done()
+	return entries[V](t.topK(key))
+}
+
+// TopKPage is like Trie.TopKPage and returns the values of the keys as well.
+func (m *Map[V]) TopKPage(key string, offset, limit int) []Entry[V] {
+	t, done := m.t.read()
+	defer done()
+	return entries[V](t.topKPage(key, offset, limit))
+}
+
+// FuzzyTopK is like Trie.FuzzyTopK and returns the values of the keys as
+// well.
+func (m *Map[V]) FuzzyTopK(prefix string, maxEdits int) []Entry[V] {
+	t, done := m.t.read()
+	defer done()
+	return entries[V](t.fuzzyTopK(prefix, maxEdits))
+}
+
+// Complete is like Trie.Complete and returns the values of the keys as
+// well.
+func (m *Map[V]) Complete(query string) []Entry[V] {
+	t, done := m.t.read()
+	defer done()
+	return entries[V](t.complete(query))
+}
+
+// Traverse returns all keys in the Map with their values. The channel must
+// be drained; use TraverseContext to stop early.
+func (m *Map[V]) Traverse() <-chan Entry[V] {
+	return m.TraverseContext(context.Background(), TraverseOptions{})
+}
+
+// TraverseContext is like Trie.TraverseContext and returns the values of
+// the keys as well.
+func (m *Map[V]) TraverseContext(ctx context.Context, opts TraverseOptions) <-chan Entry[V] {
+	t := m.t.frozen()
+	return traverse(ctx, t, opts, func(n *node, now time.Time) Entry[V] {
+		return entry[V](t.toResult(n.item(), now))
+	})
+}
+
+// entries pairs results with the values of their keys.
+func entries[V any](res []Result) []Entry[V] {
+	if res == nil {
+		return nil
+	}
+
+	out := make([]Entry[V], len(res))
+	for i, r := range res {
+		out[i] = entry[V](r)
+	}
+	return out
+}
+
+// entry pairs r with the value of its key.
+func entry[V any](r Result) Entry[V] {
+	e := Entry[V]{Result: r}
+	e.Value, _ = r.payload.get().(V)
+	e.payload = nil
+	return e
+}
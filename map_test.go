@@ -0,0 +1,113 @@
+package search_trie
+
+import (
+	"context"
+	"testing"
+)
+
+type product struct {
+	ID       int
+	Category string
+}
+
+func TestMap(t *testing.T) {
+	m := NewMap[product](3)
+	m.Put("iphone 16", 45, product{ID: 16, Category: "phones"})
+	m.Put("iphone 16 pro", 28, product{ID: 17, Category: "phones"})
+	m.Put("ipad", 35, product{ID: 20, Category: "tablets"})
+	m.Put("айфон", 30, product{ID: 16, Category: "телефоны"})
+	m.Inc("iphone")
+	if m.Has("iphone") {
+		t.Error("Inc() added a missing key")
+	}
+
+	res := m.TopK("i")
+	expected := []Entry[product]{
+		{Result{Key: "iphone 16", Frequency: 45}, product{ID: 16, Category: "phones"}},
+		{Result{Key: "ipad", Frequency: 35}, product{ID: 20, Category: "tablets"}},
+		{Result{Key: "iphone 16 pro", Frequency: 28}, product{ID: 17, Category: "phones"}},
+	}
+	if len(res) != len(expected) {
+		t.Fatalf("TopK() = %v, want %v", res, expected)
+	}
+	for i, item := range expected {
+		if res[i].Key != item.Key || res[i].Frequency != item.Frequency || res[i].Value != item.Value {
+			t.Errorf("TopK()[%d] = %v, want %v", i, res[i], item)
+		}
+	}
+
+	// Keys created without a value have the zero value
+	m.Upsert("iphone", 1)
+	if v, ok := m.Get("iphone"); !ok || v != (product{}) {
+		t.Errorf("Get(iphone) = %v, %v, want zero value, true", v, ok)
+	}
+	if _, ok := m.Get("iphone 1"); ok {
+		t.Error("Get(iphone 1) reports a missing key")
+	}
+
+	if m.Set("ipod", product{ID: 1}) {
+		t.Error("Set() of a missing key = true, want false")
+	}
+	m.Set("ipad", product{ID: 21, Category: "tablets"})
+	if res := m.TopKPage("ip", 1, 1); len(res) != 1 || res[0].Value.ID != 21 {
+		t.Errorf("TopKPage() = %v, want ipad with ID 21", res)
+	}
+	if res := m.FuzzyTopK("афон", 1); len(res) != 1 || res[0].Value.Category != "телефоны" || res[0].Distance != 1 {
+		t.Errorf("FuzzyTopK() = %v, want айфон with its value", res)
+	}
+
+	// Put overwrites the value, Add keeps it
+	m.Put("ipad", 5, product{ID: 22})
+	m.Add("ipad", 1)
+	if v, _ := m.Get("ipad"); v.ID != 22 {
+		t.Errorf("Get(ipad) = %v, want ID 22", v)
+	}
+
+	m.Delete("iphone 16")
+	m.Put("iphone 16", 1, product{})
+	values := map[string]product{}
+	for e := range m.TraverseContext(context.Background(), TraverseOptions{Prefix: "iphone"}) {
+		values[e.Key] = e.Value
+	}
+	if len(values) != 3 || values["iphone 16"] != (product{}) || values["iphone 16 pro"].ID != 17 {
+		t.Errorf("TraverseContext() = %v", values)
+	}
+}
+
+func TestMap_Scorer(t *testing.T) {
+	inStock := ScorerFunc(func(s Signals) float64 {
+		if s.Payload.(bool) {
+			return float64(s.Frequency)
+		}
+		return 0
+	})
+	m := NewMap[bool](2, WithScorer(inStock))
+	m.Put("macbook air", 10, true)
+	m.Put("macbook pro", 20, false)
+	m.Put("mac mini", 5, true)
+	expectKeyOrder(t, entryResults(m.TopK("mac")), "macbook air", "mac mini")
+
+	m.Set("macbook pro", true)
+	expectKeyOrder(t, entryResults(m.TopK("mac")), "macbook pro", "macbook air")
+}
+
+func entryResults[V any](entries []Entry[V]) []Result {
+	res := make([]Result, len(entries))
+	for i, e := range entries {
+		res[i] = e.Result
+	}
+	return res
+}
+
+func TestMap_TokenIndex(t *testing.T) {
+	m := NewMap[int](3, WithTokenIndex())
+	m.Put("iphone 16 pro", 28, 17)
+	m.Put("ipad pro", 35, 20)
+
+	// Token matches carry the values of their keys
+	m.Set("iphone 16 pro", 18)
+	res := m.Complete("pro 16")
+	if len(res) != 1 || res[0].Key != "iphone 16 pro" || res[0].Value != 18 {
+		t.Errorf("Complete() = %v, want iphone 16 pro with 18", res)
+	}
+}
@@ -2,152 +2,452 @@ package search_trie
 
 import (
 	"container/heap"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
 )
 
-type nodeInfo struct {
-	Key       string
-	Frequency uint
-}
-
+// node is a radix tree node. Chains of single-child nodes are collapsed
+// into the edge label, and children are indexed by the first rune of
+// their label.
 type node struct {
+	label     string
+	key       string // the key terminated, shared by the heaps holding it
 	frequency uint
+	weight    float64 // decayed popularity, zero without decay
+	updated   int64   // Unix nanoseconds of the last write, zero if unknown
+	payload   *payload
+	forms     []surfaceForm
+	score     float64 // rank, the weight without a Scorer
 	isEnd     bool
-	children  map[string]*node
+	children  map[rune]*node
 	topK      *topKHeap
+	gen       uint64 // generation of the writers that may change it in place
 }
 
 func newnode(topK int) *node {
 	heapInstance := &topKHeap{limit: topK}
 	heap.Init(heapInstance) // Инициализация кучи
 	return &node{
-		children: map[string]*node{},
+		children: map[rune]*node{},
 		topK:     heapInstance,
 	}
 }
 
-func (root *node) getTopK(key string) []topKHeapItem {
-	curr := root
-	prefix := ""
-	for _, r := range key {
-		prefix += string(r)
-		curr = curr.children[prefix]
-		if curr == nil {
-			return nil
+// item returns the heap item of the key terminated by the node.
+func (root *node) item() topKHeapItem {
+	return topKHeapItem{key: root.key, freq: root.frequency, score: root.score, payload: root.payload}
+}
+
+// end makes the node terminate key. The node keeps its own copy of key,
+// which the heap items of all its ancestors share.
+func (root *node) end(key string) {
+	if root.key != key {
+		root.key = strings.Clone(key)
+	}
+	root.isEnd = true
+}
+
+// firstRune returns the rune that indexes s among its siblings. Invalid
+// UTF-8 bytes are mapped to distinct negative values so they never collide.
+func firstRune(s string) rune {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError && size <= 1 {
+		return -rune(s[0]) - 1
+	}
+	return r
+}
+
+// commonPrefix returns the length in bytes of the longest common prefix
+// of a and b made of whole runes of a.
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) {
+		_, size := utf8.DecodeRuneInString(a[i:])
+		if i+size > len(b) || a[i:i+size] != b[i:i+size] {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// locate returns the node whose subtree holds exactly the keys starting
+// with prefix, together with the key that node terminates.
+func (root *node) locate(prefix string) (*node, string) {
+	curr, rest := root, prefix
+	for rest != "" {
+		child := curr.children[firstRune(rest)]
+		if child == nil {
+			return nil, ""
 		}
+		if strings.HasPrefix(child.label, rest) {
+			// The prefix ends on this edge
+			return child, prefix + child.label[len(rest):]
+		}
+		if !strings.HasPrefix(rest, child.label) {
+			return nil, ""
+		}
+
+		rest = rest[len(child.label):]
+		curr = child
+	}
+	return curr, prefix
+}
+
+func (root *node) getTopK(key string) []topKHeapItem {
+	curr, _ := root.locate(key)
+	if curr == nil {
+		return nil
 	}
 	return curr.topK.items
 }
 
-func (root *node) put(key string, frequency uint) {
-	curr, path := root, make([]*node, 0, len(key))
-	prefix := ""
+// getPage returns the items ranked offset to offset+limit-1 for prefix key.
+// It serves from the cached top-K when that covers the page and walks the
+// subtree otherwise.
+func (root *node) getPage(key string, offset, limit int) []topKHeapItem {
+	curr, _ := root.locate(key)
+	if curr == nil {
+		return nil
+	}
+
+	var items []topKHeapItem
+	if offset+limit <= curr.topK.Len() || curr.topK.Len() < curr.topK.limit {
+		// The heap is either deep enough or holds the whole subtree
+		items = append(items, curr.topK.items...)
+		sortItems(items)
+	} else {
+		c := collector{n: offset + limit}
+		c.walk(curr)
+		items = c.result()
+	}
+
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+// walk follows key from root and returns the visited nodes, ending with the
+// node that terminates key. It returns nil if key ends inside an edge or
+// leaves the tree. The visited nodes are made writable, so readers use
+// locate instead.
+func (root *node) walk(key string) []*node {
+	curr, rest := root, key
+	path := []*node{root}
+	for rest != "" {
+		child := curr.mutableChild(firstRune(rest))
+		if child == nil || !strings.HasPrefix(rest, child.label) {
+			return nil
+		}
+
+		rest = rest[len(child.label):]
+		curr = child
+		path = append(path, curr)
+	}
+	return path
+}
 
-	path = append(path, curr)
-	for _, r := range key {
-		prefix += string(r)
-		child := curr.children[prefix]
+// insert is like walk but creates and splits nodes so that the path always
+// ends with a node terminating key.
+func (root *node) insert(key string) []*node {
+	curr, rest := root, key
+	path := []*node{root}
+	for rest != "" {
+		r := firstRune(rest)
+		child := curr.mutableChild(r)
 		if child == nil {
-			if curr.children == nil {
-				curr.children = map[string]*node{}
-			}
+			// The new leaf ends key, so its label is cut from the copy of
+			// key it keeps rather than from the caller's string
+			key = strings.Clone(key)
 			child = newnode(curr.topK.limit)
-			curr.children[prefix] = child
+			child.label = key[len(key)-len(rest):]
+			child.key = key
+			child.gen = curr.gen
+			curr.children[r] = child
+		} else if c := commonPrefix(rest, child.label); c < len(child.label) {
+			child = child.split(c)
+			curr.children[r] = child
 		}
 
-		curr = curr.children[prefix]
+		rest = rest[len(child.label):]
+		curr = child
 		path = append(path, curr)
 	}
+	return path
+}
+
+// split cuts the node's label at i and returns a new node holding the first
+// part, with the original node as its only child.
+func (root *node) split(i int) *node {
+	parent := newnode(root.topK.limit)
+	parent.gen = root.gen
+	parent.label = root.label[:i]
+	parent.topK.set(append([]topKHeapItem(nil), root.topK.items...))
+
+	root.label = root.label[i:]
+	parent.children[firstRune(root.label)] = root
+	return parent
+}
+
+// own returns the node if it belongs to generation gen, and a copy of it
+// that does otherwise.
+func (root *node) own(gen uint64) *node {
+	if root.gen == gen {
+		return root
+	}
+	n := *root
+	n.gen = gen
+	n.children = maps.Clone(root.children)
+	n.topK = root.topK.clone()
+	n.forms = slices.Clone(root.forms)
+	return &n
+}
+
+// mutableChild returns the child indexed by r, or nil, after replacing it
+// with a copy if it belongs to an older generation than the node.
+func (root *node) mutableChild(r rune) *node {
+	child := root.children[r]
+	if child == nil || child.gen == root.gen {
+		return child
+	}
+	child = child.own(root.gen)
+	root.children[r] = child
+	return child
+}
+
+// mergeChild folds the node's only child into it.
+func (root *node) mergeChild() {
+	for r := range root.children {
+		child := root.mutableChild(r)
+		root.label += child.label
+		root.copyEnd(child)
+		root.children = child.children
+		root.topK = child.topK
+	}
+}
+
+// copyEnd makes the node terminate the key src terminates, if any, with
+// everything stored about it.
+func (root *node) copyEnd(src *node) {
+	root.isEnd = src.isEnd
+	root.key = src.key
+	root.frequency = src.frequency
+	root.weight = src.weight
+	root.updated = src.updated
+	root.payload = src.payload
+	root.forms = src.forms
+	root.score = src.score
+}
+
+// put sets the frequency of key, replacing the one it had, and its payload
+// unless p is nil.
+func (root *node) put(key string, frequency uint, p *payload, s stamp) {
+	path := root.insert(key)
+	curr := path[len(path)-1]
+	existed := curr.isEnd
+	old := curr.item()
 
-	curr.isEnd = true
+	curr.end(key)
+	if p != nil {
+		curr.payload = p
+	}
 	curr.frequency = frequency
+	curr.weight = s.set(frequency)
+	curr.touch(key, s)
 
-	for _, n := range path {
-		n.updateTopK(key, frequency)
+	item := curr.item()
+	if !existed {
+		for _, n := range path {
+			n.updateTopK(item)
+		}
+	} else {
+		rerank(path, old, item)
 	}
 }
 
 func (root *node) has(key string) bool {
-	curr := root
-	prefix := ""
+	curr, full := root.locate(key)
+	return curr != nil && full == key && curr.isEnd
+}
 
-	for _, r := range key {
-		prefix += string(r)
-		child := curr.children[prefix]
-		if child == nil {
-			return false
-		}
+func (root *node) inc(key string, s stamp) {
+	root.add(key, 1, false, s)
+}
 
-		curr = curr.children[prefix]
+// add changes the frequency of key by delta, saturating at zero and at the
+// maximum uint, and returns the new frequency and whether the key existed.
+// A missing key is created if upsert is set and left alone otherwise.
+func (root *node) add(key string, delta int64, upsert bool, s stamp) (uint, bool) {
+	var path []*node
+	if upsert {
+		path = root.insert(key)
+	} else if path = root.walk(key); path == nil {
+		return 0, false
 	}
-	if !curr.isEnd {
-		return false
+	curr := path[len(path)-1]
+	existed := curr.isEnd
+	if !existed && !upsert {
+		return 0, false
 	}
 
-	return true
+	old := curr.item()
+	if !existed {
+		curr.frequency, curr.weight = 0, s.set(0)
+	}
+	curr.end(key)
+	curr.frequency = saturatingAdd(curr.frequency, delta)
+	curr.weight = s.add(curr.weight, delta)
+	curr.touch(key, s)
+
+	item := curr.item()
+	if !existed {
+		for _, n := range path {
+			n.updateTopK(item)
+		}
+	} else {
+		rerank(path, old, item)
+	}
+	return curr.frequency, existed
 }
 
-func (root *node) inc(key string) {
-	curr, path := root, make([]*node, 0, len(key))
-	prefix := ""
+// rerank moves the key of item, whose rank changed from old, in the top-K
+// along path.
+func rerank(path []*node, old, item topKHeapItem) {
+	if item.less(old) {
+		updateTopKDown(path, item)
+		return
+	}
+	for _, n := range path {
+		n.updateTopK(item)
+	}
+}
 
-	path = append(path, curr)
-	for _, r := range key {
-		prefix += string(r)
-		child := curr.children[prefix]
-		if child == nil {
-			return
+// updateTopKDown lowers the rank of item in the top-K along path, the nodes
+// from the root to the one terminating its key. A node whose heap is full is
+// rebuilt from its children, bottom-up, so that the best key left out of the
+// heap so far can take the place of item.
+func updateTopKDown(path []*node, item topKHeapItem) {
+	key := item.key
+	for i := len(path) - 1; i >= 0; i-- {
+		n := path[i]
+		j := n.topK.indexOf(key)
+		if j < 0 {
+			continue
+		}
+		if n.topK.Len() < n.topK.limit {
+			// The heap holds the whole subtree, nothing can replace key
+			n.topK.replace(j, item)
+			continue
 		}
+		n.rebuildTopK()
+	}
+}
 
-		curr = curr.children[prefix]
-		path = append(path, curr)
+func saturatingAdd(freq uint, delta int64) uint {
+	f, max := uint64(freq), uint64(^uint(0))
+	if delta < 0 {
+		d := uint64(-delta)
+		if d >= f {
+			return 0
+		}
+		return uint(f - d)
+	}
+	if d := uint64(delta); d > max-f {
+		return uint(max)
 	}
+	return uint(f + uint64(delta))
+}
+
+func (root *node) delete(key string) bool {
+	path := root.walk(key)
+	if path == nil {
+		return false
+	}
+	curr := path[len(path)-1]
 	if !curr.isEnd {
-		return
+		return false
 	}
 
-	curr.frequency += 1
+	curr.isEnd = false
+	curr.key = ""
+	curr.frequency = 0
+	curr.weight = 0
+	curr.updated = 0
+	curr.payload = nil
+	curr.forms = nil
+	curr.score = 0
 
-	for _, n := range path {
-		n.updateTopK(key, curr.frequency)
+	// Prune nodes that no longer lead to any terminal and collapse
+	// the ones left with a single child
+	for i := len(path) - 1; i > 0; i-- {
+		n := path[i]
+		if n.isEnd || len(n.children) > 1 {
+			break
+		}
+		if len(n.children) == 1 {
+			n.mergeChild()
+			break
+		}
+		delete(path[i-1].children, firstRune(n.label))
+		path = path[:i]
+	}
+
+	// Repair top-K of the remaining ancestors, bottom-up
+	for i := len(path) - 1; i >= 0; i-- {
+		path[i].rebuildTopK()
 	}
+
+	return true
 }
 
-func (root *node) updateTopK(key string, freq uint) {
-	for i, item := range root.topK.items {
-		if item.key == key {
-			// Update existing key
-			root.topK.items[i].freq = freq
-			heap.Fix(root.topK, i) // Reorder the heap
-			return
-		}
+// rebuildTopK recomputes the node's top-K from its own entry and the
+// top-K of its children.
+func (root *node) rebuildTopK() {
+	var items []topKHeapItem
+	if root.isEnd {
+		items = append(items, root.item())
+	}
+	for _, child := range root.children {
+		items = append(items, child.topK.items...)
 	}
 
-	// Add new key
-	heap.Push(root.topK, topKHeapItem{key: key, freq: freq})
-	if root.topK.Len() > root.topK.limit {
-		root.topK.Pop()
+	sortItems(items)
+	if len(items) > root.topK.limit {
+		items = items[:root.topK.limit]
 	}
-}
 
-func (root *node) traverse() <-chan nodeInfo {
-	out := make(chan nodeInfo, 100)
-	go func() {
-		defer close(out)
-		root.traverseHelper("", out)
-	}()
+	root.topK.set(items)
+}
 
-	return out
+// rebuildAllTopK recomputes the top-K of every node of the subtree,
+// bottom-up.
+func (root *node) rebuildAllTopK() {
+	for r := range root.children {
+		root.mutableChild(r).rebuildAllTopK()
+	}
+	root.rebuildTopK()
 }
 
-func (root *node) traverseHelper(prefix string, out chan<- nodeInfo) {
-	if prefix != "" && root.isEnd {
-		out <- nodeInfo{
-			Key:       prefix,
-			Frequency: root.frequency,
-		}
+func (root *node) updateTopK(item topKHeapItem) {
+	if i := root.topK.indexOf(item.key); i >= 0 {
+		// Update existing key
+		root.topK.replace(i, item) // Reorder the heap
+		return
 	}
 
-	for r, child := range root.children {
-		child.traverseHelper(r, out)
+	// Add new key
+	if root.topK.Len() < root.topK.limit {
+		heap.Push(root.topK, item)
+		return
+	}
+	if root.topK.items[0].less(item) {
+		root.topK.replace(0, item) // Evict the lowest ranked key
 	}
 }
@@ -0,0 +1,235 @@
+package search_trie
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalizer maps a key to the canonical form it is stored and looked up
+// by. Normalize must be idempotent and safe for concurrent use.
+type Normalizer interface {
+	Normalize(s string) string
+}
+
+// NormalizerFunc adapts a function to the Normalizer interface.
+type NormalizerFunc func(s string) string
+
+// Normalize returns f(s).
+func (f NormalizerFunc) Normalize(s string) string {
+	return f(s)
+}
+
+// Chain returns a Normalizer applying ns in order.
+func Chain(ns ...Normalizer) Normalizer {
+	return NormalizerFunc(func(s string) string {
+		for _, n := range ns {
+			s = n.Normalize(s)
+		}
+		return s
+	})
+}
+
+var (
+	// NFKC composes s into Unicode normalization form KC, so that NFC and
+	// NFD spellings and compatibility characters such as fullwidth letters
+	// agree.
+	NFKC Normalizer = NormalizerFunc(norm.NFKC.String)
+
+	// FoldCase applies Unicode case folding.
+	FoldCase Normalizer = NormalizerFunc(func(s string) string {
+		return cases.Fold().String(s) // Caser хранит состояние, не переиспользуем
+	})
+
+	// StripDiacritics removes accents from Latin letters, so "café" matches
+	// "cafe". Letters of other scripts, such as Cyrillic й, are kept.
+	StripDiacritics Normalizer = NormalizerFunc(stripDiacritics)
+
+	// FoldYo replaces ё with е.
+	FoldYo Normalizer = NormalizerFunc(strings.NewReplacer("ё", "е", "Ё", "Е").Replace)
+
+	// CollapseSpace turns runs of whitespace into a single space and drops
+	// leading ones. A trailing run is kept as one space, so that a prefix
+	// can still end on a word boundary.
+	CollapseSpace Normalizer = NormalizerFunc(collapseSpace)
+
+	// DefaultNormalizer chains all of the above.
+	DefaultNormalizer = Chain(NFKC, FoldCase, StripDiacritics, FoldYo, CollapseSpace)
+)
+
+func stripDiacritics(s string) string {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return s
+	}
+
+	var b strings.Builder
+	latin := false
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			if latin {
+				continue
+			}
+		} else {
+			latin = unicode.Is(unicode.Latin, r)
+		}
+		b.WriteRune(r)
+	}
+	return norm.NFC.String(b.String())
+}
+
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// WithNormalizer stores and looks up keys by their form under n, so that
+// for example "iPhone" and "IPHONE" count as one key. Results show the
+// spelling of each key written most.
+func WithNormalizer(n Normalizer) Option {
+	return func(o *options) {
+		o.normalizer = n
+	}
+}
+
+func (t *Trie) normalize(key string) string {
+	if t.normalizer == nil {
+		return key
+	}
+	return t.normalizer.Normalize(key)
+}
+
+// credit records form as a spelling of key after a write by op with value.
+// Forms are credited with the frequency they add. Put starts the credit
+// over and a negative delta takes it back from every spelling alike, so
+// the display form follows the live counts.
+func (t *Trie) credit(key, form string, op byte, value uint64) {
+	if t.normalizer == nil || op == opDelete {
+		return
+	}
+	path := t.root.walk(key)
+	if path == nil || !path[len(path)-1].isEnd {
+		return
+	}
+	curr := path[len(path)-1]
+
+	var amount uint
+	switch op {
+	case opPut:
+		curr.forms = nil
+		amount = uint(value)
+	case opInc:
+		amount = 1
+	case opAdd, opUpsert:
+		if delta := int64(value); delta > 0 {
+			amount = uint(delta)
+		} else {
+			curr.scaleForms(curr.frequency)
+		}
+	}
+	curr.creditForm(form, amount)
+}
+
+// display returns the spelling to show for key.
+func (t *Trie) display(key string) string {
+	if t.normalizer == nil {
+		return key
+	}
+	if curr, full := t.rootOf(key).locate(key); curr != nil && full == key {
+		return curr.display(key)
+	}
+	return key
+}
+
+// surfaceForm is a spelling of a normalized key, credited with the
+// frequency written under it.
+type surfaceForm struct {
+	form  string
+	count uint
+}
+
+// maxSurfaceForms bounds the spellings kept per key.
+const maxSurfaceForms = 4
+
+func (root *node) creditForm(form string, amount uint) {
+	for i := range root.forms {
+		if f := &root.forms[i]; f.form == form {
+			if f.count > ^uint(0)-amount {
+				f.count = ^uint(0)
+			} else {
+				f.count += amount
+			}
+			return
+		}
+	}
+	if len(root.forms) < maxSurfaceForms {
+		root.forms = append(root.forms, surfaceForm{form: form, count: amount})
+		return
+	}
+
+	// Replace the least credited spelling if the new one outweighs it
+	min := 0
+	for i, f := range root.forms {
+		if f.count < root.forms[min].count {
+			min = i
+		}
+	}
+	if root.forms[min].count < amount {
+		root.forms[min] = surfaceForm{form: form, count: amount}
+	}
+}
+
+// scaleForms scales the credit of every spelling down in proportion, so
+// that together they count no more than total.
+func (root *node) scaleForms(total uint) {
+	var sum float64
+	for _, f := range root.forms {
+		sum += float64(f.count)
+	}
+	if sum <= float64(total) {
+		return
+	}
+	for i := range root.forms {
+		f := &root.forms[i]
+		f.count = uint(float64(f.count) * float64(total) / sum)
+	}
+}
+
+// display returns the most credited spelling of key, terminated by the
+// node, or key itself if none is known.
+func (root *node) display(key string) string {
+	if len(root.forms) == 0 {
+		return key
+	}
+	best := root.forms[0]
+	for _, f := range root.forms[1:] {
+		if f.count > best.count {
+			best = f
+		}
+	}
+	return best.form
+}
@@ -0,0 +1,140 @@
+package search_trie
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDefaultNormalizer(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"iPhone", "iphone"},
+		{"IPHONE 16 Pro", "iphone 16 pro"},
+		{"ｉｐｈｏｎｅ", "iphone"},
+		{"Straße", "strasse"},
+		{"café", "cafe"},
+		{"café", "cafe"},
+		{"Ёлка", "елка"},
+		{"ёлка", "елка"},
+		{"Йогурт", "йогурт"},
+		{"  iphone \t 16  ", "iphone 16 "},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := DefaultNormalizer.Normalize(tt.input); got != tt.expected {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+		if got := DefaultNormalizer.Normalize(tt.expected); got != tt.expected {
+			t.Errorf("Normalize(%q) = %q, want it unchanged", tt.expected, got)
+		}
+	}
+}
+
+func TestTrie_Normalizer(t *testing.T) {
+	trie := NewTrie(5, WithNormalizer(DefaultNormalizer))
+	trie.Put("iPhone 16", 10)
+	trie.Inc("iphone 16")
+	trie.Inc("IPHONE  16")
+	trie.Put("Ёлка", 3)
+	trie.Inc("елка")
+	trie.Upsert("ёлка", 2)
+
+	if !trie.Has("Iphone 16") || !trie.Has("ЕЛКА") {
+		t.Error("Has() misses a key written in another spelling")
+	}
+
+	// Counts merge, the spelling written most is shown
+	expectScores(t, trie.TopK("IPH"), []Result{{Key: "iPhone 16", Frequency: 12, Score: 12}})
+	expectScores(t, trie.TopK("ел"), []Result{{Key: "Ёлка", Frequency: 6, Score: 6}})
+
+	trie.Add("iphone 16", 20)
+	expectScores(t, trie.TopKPage(" iphone ", 0, 5), []Result{{Key: "iphone 16", Frequency: 32, Score: 32}})
+	if res := trie.FuzzyTopK("IPHINE", 1); len(res) != 1 || res[0].Key != "iphone 16" {
+		t.Errorf("FuzzyTopK() = %v, want iphone 16", res)
+	}
+
+	it := trie.Iter(IterOptions{From: "Ё"})
+	it.Seek("ЕЛ")
+	if !it.Next() || it.Result().Key != "Ёлка" || it.Next() {
+		t.Error("Iter() does not find Ёлка")
+	}
+
+	if !trie.Delete("ЁЛКА") || trie.Has("елка") {
+		t.Error("Delete() leaves the key in place")
+	}
+	trie.Put("елка", 1)
+	expectScores(t, trie.TopK("ел"), []Result{{Key: "елка", Frequency: 1, Score: 1}})
+}
+
+func TestTrie_NormalizerBatch(t *testing.T) {
+	trie := NewTrie(5, WithNormalizer(FoldCase))
+
+	var b Batch
+	b.Put("MacBook", 3)
+	b.Inc("macbook")
+	b.Upsert("MacBook", 1)
+	b.Add("MACBOOK", -2)
+	trie.Apply(&b)
+
+	expectScores(t, trie.TopK("mac"), []Result{{Key: "MacBook", Frequency: 3, Score: 3}})
+}
+
+func TestTrie_NormalizerLiveCounts(t *testing.T) {
+	trie := NewTrie(5, WithNormalizer(FoldCase))
+
+	// Put starts the count over
+	trie.Put("iPhone", 100)
+	trie.Put("IPHONE", 5)
+	expectScores(t, trie.TopK("i"), []Result{{Key: "IPHONE", Frequency: 5, Score: 5}})
+
+	// A negative delta takes from every spelling alike
+	trie.Put("MacBook", 10)
+	trie.Add("macbook", 6)
+	trie.Add("MACBOOK", -12)
+	trie.Add("MACBOOK", 3)
+	expectScores(t, trie.TopK("m"), []Result{{Key: "MACBOOK", Frequency: 7, Score: 7}})
+}
+
+func TestTrie_NormalizerSnapshot(t *testing.T) {
+	trie := NewTrie(5, WithNormalizer(DefaultNormalizer))
+	trie.Put("Самсунг", 5)
+	trie.Inc("САМСУНГ")
+	trie.Put("Samsung", 7)
+
+	var buf bytes.Buffer
+	if _, err := trie.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	loaded := NewTrie(5, WithNormalizer(DefaultNormalizer))
+	if _, err := loaded.ReadFrom(&buf); err != nil {
+		t.Fatalf("ReadFrom() error = %v", err)
+	}
+
+	expected := []Result{{Key: "Samsung", Frequency: 7, Score: 7}, {Key: "Самсунг", Frequency: 6, Score: 6}}
+	expectScores(t, loaded.TopK("s"), expected[:1])
+	expectScores(t, loaded.TopK("с"), expected[1:])
+}
+
+func TestOpen_Normalizer(t *testing.T) {
+	dir := t.TempDir()
+
+	trie, err := Open(dir, 5, LogOptions{}, WithNormalizer(DefaultNormalizer))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	trie.Put("Ёж", 2)
+	trie.Inc("ЕЖ")
+	trie.Inc("ЕЖ")
+	trie.Inc("ЕЖ")
+	trie.Close()
+
+	trie, err = Open(dir, 5, LogOptions{}, WithNormalizer(DefaultNormalizer))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer trie.Close()
+	expectScores(t, trie.TopK("е"), []Result{{Key: "ЕЖ", Frequency: 5, Score: 5}})
+}
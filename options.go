@@ -0,0 +1,26 @@
+package search_trie
+
+import "time"
+
+// Option configures a Trie.
+type Option func(*options)
+
+type options struct {
+	halfLife    time.Duration
+	scorer      Scorer
+	normalizer  Normalizer
+	corrections Corrections
+	tokens      bool
+	highlights  bool
+	cow         bool
+	publish     time.Duration
+	now         func() time.Time
+}
+
+// WithClock sets the time source used for decay and for Signals.Updated,
+// time.Now by default.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
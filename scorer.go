@@ -0,0 +1,170 @@
+package search_trie
+
+import (
+	"math"
+	"time"
+)
+
+// Scorer computes the score keys are ranked by. Higher scores rank first;
+// ties are broken by frequency, then by the shorter key, then
+// lexicographically.
+//
+// A key is scored when it is written and keeps its score until its next
+// write, so Score must not depend on the time of the query. Use WithDecay
+// for popularity that fades over time.
+type Scorer interface {
+	Score(s Signals) float64
+}
+
+// ScorerFunc adapts a function to the Scorer interface.
+type ScorerFunc func(s Signals) float64
+
+// Score returns f(s).
+func (f ScorerFunc) Score(s Signals) float64 {
+	return f(s)
+}
+
+// Signals describes a key at the time it is scored.
+type Signals struct {
+	Key       string
+	Frequency uint
+	// Popularity is the decayed popularity of Key at Updated for tries
+	// created WithDecay, and Frequency otherwise.
+	Popularity float64
+	// Updated is the time of the last write to Key. It is zero for keys
+	// loaded from a snapshot that did not record it.
+	Updated time.Time
+	// Payload is the value set by SetPayload, or nil.
+	Payload any
+}
+
+// WithScorer ranks keys by the scores s computes instead of by frequency.
+// A NaN score ranks below all others.
+func WithScorer(s Scorer) Option {
+	return func(o *options) {
+		o.scorer = s
+	}
+}
+
+// SetPayload attaches value to key for the Trie's Scorer and rescores it.
+// It reports false and does nothing if the key is missing. Payloads are
+// kept in memory only: they are neither logged nor written to snapshots.
+func (t *Trie) SetPayload(key string, value any) bool {
+	t.lock()
+	defer t.unlock()
+	return t.setPayload(key, value)
+}
+
+// payload is a value attached to a key. Nodes hold it by pointer, so that
+// those without one do not pay for an interface.
+type payload struct {
+	value any
+}
+
+// get returns the value, or nil for a nil payload.
+func (p *payload) get() any {
+	if p == nil {
+		return nil
+	}
+	return p.value
+}
+
+func (t *Trie) setPayload(key string, value any) bool {
+	key = t.normalize(key)
+	path := t.root.walk(key)
+	if path == nil || !path[len(path)-1].isEnd {
+		return false
+	}
+	curr := path[len(path)-1]
+
+	// A new payload is not activity, the key keeps its time
+	old := curr.item()
+	curr.payload = &payload{value: value}
+	curr.score = t.stampOf(curr).score(key, curr)
+	rerank(path, old, curr.item())
+	t.reindex(key)
+	return true
+}
+
+// timed reports whether writes carry their time.
+func (t *Trie) timed() bool {
+	return t.decay.enabled() || t.scorer != nil
+}
+
+// stamp returns the stamp of a write happening now.
+func (t *Trie) stamp() stamp {
+	if !t.timed() {
+		return stamp{}
+	}
+	return t.stampAt(t.now())
+}
+
+// stampAt returns the stamp of a write at the given time.
+func (t *Trie) stampAt(at time.Time) stamp {
+	if !t.timed() {
+		return stamp{}
+	}
+	s := t.decay.stamp(at)
+	s.time, s.scorer = at, t.scorer
+	return s
+}
+
+// stampOf returns the stamp of the last write to the key terminated by n.
+func (t *Trie) stampOf(n *node) stamp {
+	if n.updated != 0 {
+		return t.stampAt(time.Unix(0, n.updated))
+	}
+	// The time is unknown, read the weight at the epoch
+	s := t.stampAt(t.decay.epoch)
+	s.time = time.Time{}
+	return s
+}
+
+// rescore recomputes the score of every key and rebuilds all heaps. It is
+// needed after loading keys that may have been ranked by another Scorer.
+func (t *Trie) rescore() {
+	t.root.rescore(t.stampOf)
+}
+
+func (root *node) rescore(stampOf func(*node) stamp) {
+	if root.isEnd {
+		root.score = stampOf(root).score(root.key, root)
+	}
+	for r := range root.children {
+		root.mutableChild(r).rescore(stampOf)
+	}
+	root.rebuildTopK()
+}
+
+// touch records a write to the key terminated by the node and recomputes
+// its score.
+func (root *node) touch(key string, s stamp) {
+	if !s.time.IsZero() {
+		root.updated = s.time.UnixNano()
+	}
+	root.score = s.score(key, root)
+}
+
+// score returns the score of key, terminated by n. Without a Scorer it is
+// the key's weight.
+func (s stamp) score(key string, n *node) float64 {
+	if s.scorer == nil {
+		return n.weight
+	}
+
+	sig := Signals{
+		Key:        key,
+		Frequency:  n.frequency,
+		Popularity: float64(n.frequency),
+		Updated:    s.time,
+		Payload:    n.payload.get(),
+	}
+	if s.decayed {
+		sig.Popularity = math.Exp2(n.weight - s.at)
+	}
+	score := s.scorer.Score(sig)
+	if math.IsNaN(score) {
+		return math.Inf(-1)
+	}
+	return score
+}
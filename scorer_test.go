@@ -0,0 +1,162 @@
+package search_trie
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func expectKeyOrder(t *testing.T, res []Result, keys ...string) {
+	t.Helper()
+
+	if len(res) != len(keys) {
+		t.Fatalf("got %v, want keys %q", res, keys)
+	}
+	for i, key := range keys {
+		if res[i].Key != key {
+			t.Fatalf("got %v, want keys %q", res, keys)
+		}
+	}
+}
+
+func TestTrie_TopKTies(t *testing.T) {
+	trie := NewTrie(3)
+	for _, key := range []string{"iphone 16", "iphone 15", "iphone", "iphone 16 pro", "айфон"} {
+		trie.Put(key, 10)
+	}
+
+	// Shorter keys first, then lexicographic; the heap keeps the same three
+	expectKeyOrder(t, trie.TopK("i"), "iphone", "iphone 15", "iphone 16")
+	expectKeyOrder(t, trie.TopKPage("iphone", 1, 3), "iphone 15", "iphone 16", "iphone 16 pro")
+	expectKeyOrder(t, trie.FuzzyTopK("iphane", 1), "iphone", "iphone 15", "iphone 16")
+}
+
+func TestTrie_Scorer(t *testing.T) {
+	// Favour short keys: frequency per rune
+	perRune := ScorerFunc(func(s Signals) float64 {
+		return float64(s.Frequency) / float64(len([]rune(s.Key)))
+	})
+	trie := NewTrie(3, WithScorer(perRune))
+	trie.Put("iphone", 30)
+	trie.Put("iphone 16", 54)
+	trie.Put("iphone 16 pro max", 68)
+	trie.Put("ipad", 16)
+
+	res := trie.TopK("ip")
+	expectKeyOrder(t, res, "iphone 16", "iphone", "iphone 16 pro max")
+	if res[0].Score != 6 || res[0].Frequency != 54 {
+		t.Errorf("got %v, want score 6 and frequency 54", res[0])
+	}
+
+	// Writes rescore the key
+	trie.Add("iphone 16", -27)
+	expectKeyOrder(t, trie.TopK("ip"), "iphone", "iphone 16 pro max", "ipad")
+	trie.Inc("ipad")
+	trie.Inc("ipad")
+	trie.Inc("ipad")
+	expectKeyOrder(t, trie.TopK("ip"), "iphone", "ipad", "iphone 16 pro max")
+	expectKeyOrder(t, trie.TopK("iphone"), "iphone", "iphone 16 pro max", "iphone 16")
+}
+
+func TestTrie_SetPayload(t *testing.T) {
+	boosted := ScorerFunc(func(s Signals) float64 {
+		boost, _ := s.Payload.(float64)
+		return float64(s.Frequency) + boost
+	})
+	trie := NewTrie(2, WithScorer(boosted))
+	trie.Put("macbook air", 10)
+	trie.Put("macbook pro", 20)
+	trie.Put("macbook neo", 5)
+	trie.Put("mac mini", 8)
+
+	if trie.SetPayload("macbook", 1.0) {
+		t.Error("SetPayload() of a missing key = true, want false")
+	}
+
+	if !trie.SetPayload("macbook neo", 100.0) {
+		t.Error("SetPayload() = false, want true")
+	}
+	expectKeyOrder(t, trie.TopK("mac"), "macbook neo", "macbook pro")
+	expectKeyOrder(t, trie.TopK("macbook"), "macbook neo", "macbook pro")
+
+	// Lowering the boost brings back the keys left out of the heaps
+	trie.SetPayload("macbook neo", -100.0)
+	expectKeyOrder(t, trie.TopK("mac"), "macbook pro", "macbook air")
+	expectKeyOrder(t, trie.TopK("macbook"), "macbook pro", "macbook air")
+
+	// The payload stays with the key across writes until it is deleted
+	trie.Put("macbook neo", 200)
+	expectKeyOrder(t, trie.TopK("mac"), "macbook neo", "macbook pro")
+	trie.Delete("macbook neo")
+	trie.Put("macbook neo", 200)
+	if res := trie.TopK("macbook neo"); res[0].Score != 200 {
+		t.Errorf("got %v, want score 200", res[0])
+	}
+}
+
+func TestTrie_ScorerRecency(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)}
+	// One frequency point is worth a day
+	fresh := ScorerFunc(func(s Signals) float64 {
+		return float64(s.Frequency) + float64(s.Updated.Unix())/86400
+	})
+	trie := NewTrie(5, WithScorer(fresh), WithClock(clock.Now))
+
+	trie.Put("iphone 15", 20)
+	clock.Advance(30 * 24 * time.Hour)
+	trie.Put("iphone 16", 5)
+	expectKeyOrder(t, trie.TopK("iphone"), "iphone 16", "iphone 15")
+
+	clock.Advance(24 * time.Hour)
+	trie.Add("iphone 15", 20)
+	expectKeyOrder(t, trie.TopK("iphone"), "iphone 15", "iphone 16")
+}
+
+func TestTrie_ScorerDecay(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)}
+	var popularity []float64
+	recorder := ScorerFunc(func(s Signals) float64 {
+		popularity = append(popularity, s.Popularity)
+		return s.Popularity
+	})
+	trie := NewTrie(5, WithDecay(time.Hour), WithScorer(recorder), WithClock(clock.Now))
+
+	trie.Put("ipad", 8)
+	clock.Advance(2 * time.Hour)
+	trie.Inc("ipad")
+
+	if len(popularity) != 2 || popularity[0] != 8 || popularity[1] != 3 {
+		t.Errorf("got popularity %v, want [8 3]", popularity)
+	}
+}
+
+func TestTrie_ScorerSnapshot(t *testing.T) {
+	reverse := ScorerFunc(func(s Signals) float64 {
+		return -float64(s.Frequency)
+	})
+	scored := NewTrie(2, WithScorer(reverse))
+	for key, freq := range map[string]uint{"кофе": 10, "кофемашина": 5, "кофта": 1} {
+		scored.Put(key, freq)
+	}
+	expectKeyOrder(t, scored.TopK("ко"), "кофта", "кофемашина")
+
+	var buf bytes.Buffer
+	if _, err := scored.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	data := buf.Bytes()
+
+	// Keys are ranked by whatever the loading trie uses
+	plain := NewTrie(2)
+	if _, err := plain.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatalf("ReadFrom() error = %v", err)
+	}
+	expectKeyOrder(t, plain.TopK("ко"), "кофе", "кофемашина")
+
+	loaded := NewTrie(2, WithScorer(reverse))
+	if _, err := loaded.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatalf("ReadFrom() error = %v", err)
+	}
+	expectKeyOrder(t, loaded.TopK("ко"), "кофта", "кофемашина")
+	expectKeyOrder(t, loaded.TopK("кофе"), "кофемашина", "кофе")
+}
@@ -0,0 +1,508 @@
+package search_trie
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"slices"
+	"unicode/utf8"
+)
+
+// ShardOptions configure how a ShardedTrie splits keys.
+type ShardOptions struct {
+	// Shards is the number of shards, GOMAXPROCS by default.
+	Shards int
+	// Runes is the number of leading runes of a key that pick its shard,
+	// 2 by default. Prefixes at least that long are served by a single
+	// shard, so it should be short, but long enough to spread keys that
+	// share a common start.
+	Runes int
+}
+
+// ShardedTrie is a Trie split into shards by the leading runes of keys,
+// each with its own lock, so that writes to different shards do not wait
+// for each other. It has the API of a Trie. Queries for shorter prefixes,
+// fuzzy queries, Complete, token matches and corrections read all shards
+// and merge their results, ranked as a single Trie would rank them.
+//
+// A ShardedTrie has no write-ahead log; persist it with WriteTo.
+type ShardedTrie struct {
+	shards *shardSet
+	q      *Trie // ranks and formats results over the shards
+}
+
+var _ Index = (*ShardedTrie)(nil)
+
+// shardSet is the shards of a ShardedTrie.
+type shardSet struct {
+	tries []*Trie
+	runes int
+}
+
+// NewShardedTrie creates a ShardedTrie with the given topK limit and
+// options for every shard.
+func NewShardedTrie(topK int, opts ShardOptions, trieOpts ...Option) *ShardedTrie {
+	if opts.Shards <= 0 {
+		opts.Shards = runtime.GOMAXPROCS(0)
+	}
+	if opts.Runes <= 0 {
+		opts.Runes = 2
+	}
+
+	// Shards are read under their locks, copies for readers would be wasted
+	trieOpts = append(trieOpts[:len(trieOpts):len(trieOpts)], func(o *options) { o.cow = false })
+	q := NewTrie(topK, trieOpts...)
+	q.shards = &shardSet{tries: make([]*Trie, opts.Shards), runes: opts.Runes}
+	for i := range q.shards.tries {
+		shard := NewTrie(topK, trieOpts...)
+		// Weights are only comparable across shards from the same epoch
+		shard.decay = q.decay
+		q.shards.tries[i] = shard
+	}
+	return &ShardedTrie{shards: q.shards, q: q}
+}
+
+// prefix returns the leading runes of key that pick its shard, and whether
+// key has that many.
+func (s *shardSet) prefix(key string) (string, bool) {
+	i := 0
+	for r := 0; r < s.runes; r++ {
+		if i == len(key) {
+			return key, false
+		}
+		_, size := utf8.DecodeRuneInString(key[i:])
+		i += size
+	}
+	return key[:i], true
+}
+
+// index returns the index of the shard holding key.
+func (s *shardSet) index(key string) int {
+	p, _ := s.prefix(key)
+	// FNV-1a
+	h := uint32(2166136261)
+	for i := 0; i < len(p); i++ {
+		h ^= uint32(p[i])
+		h *= 16777619
+	}
+	return int(h % uint32(len(s.tries)))
+}
+
+// holding returns the shard holding every key starting with prefix, and
+// false if they may be in any shard.
+func (s *shardSet) holding(prefix string) (int, bool) {
+	if _, ok := s.prefix(prefix); !ok {
+		return 0, false
+	}
+	return s.index(prefix), true
+}
+
+// shard returns the shard holding key.
+func (s *ShardedTrie) shard(key string) *Trie {
+	return s.shards.tries[s.shards.index(s.q.normalize(key))]
+}
+
+// reading returns the shards a query for prefix reads: the one holding
+// the keys starting with prefix if the query reads no other keys, and all
+// of them otherwise.
+func (s *ShardedTrie) reading(prefix string, narrow bool) []*Trie {
+	if narrow {
+		if i, ok := s.shards.holding(s.q.normalize(prefix)); ok {
+			return s.shards.tries[i : i+1]
+		}
+	}
+	return s.shards.tries
+}
+
+// rlock read-locks shards in order, so that readers of several shards
+// never deadlock.
+func rlock(shards []*Trie) {
+	for _, t := range shards {
+		t.mu.RLock()
+	}
+}
+
+func runlock(shards []*Trie) {
+	for _, t := range shards {
+		t.mu.RUnlock()
+	}
+}
+
+// TopK returns the top K keys for prefix, like Trie.TopK.
+func (s *ShardedTrie) TopK(key string) []Result {
+	shards := s.reading(key, s.q.tokens == nil && !s.q.corrections.enabled())
+	rlock(shards)
+	defer runlock(shards)
+	return s.q.topK(key)
+}
+
+// TopKPage returns a page of the keys for prefix, like Trie.TopKPage.
+func (s *ShardedTrie) TopKPage(key string, offset, limit int) []Result {
+	shards := s.reading(key, true)
+	rlock(shards)
+	defer runlock(shards)
+	return s.q.topKPage(key, offset, limit)
+}
+
+// FuzzyTopK returns the top K keys close to prefix, like Trie.FuzzyTopK.
+func (s *ShardedTrie) FuzzyTopK(prefix string, maxEdits int) []Result {
+	rlock(s.shards.tries)
+	defer runlock(s.shards.tries)
+	return s.q.fuzzyTopK(prefix, maxEdits)
+}
+
+// Complete returns the top K keys containing the words of query, like
+// Trie.Complete.
+func (s *ShardedTrie) Complete(query string) []Result {
+	rlock(s.shards.tries)
+	defer runlock(s.shards.tries)
+	return s.q.complete(query)
+}
+
+// Has checks trie has the key.
+func (s *ShardedTrie) Has(key string) bool {
+	return s.shard(key).Has(key)
+}
+
+// Traverse returns all keys of all shards. The channel must be drained;
+// use TraverseContext to stop early.
+func (s *ShardedTrie) Traverse() <-chan Result {
+	return s.TraverseContext(context.Background(), TraverseOptions{})
+}
+
+// TraverseContext returns the keys of all shards as of the call, like
+// Trie.TraverseContext.
+func (s *ShardedTrie) TraverseContext(ctx context.Context, opts TraverseOptions) <-chan Result {
+	return s.Snapshot().t.traverse(ctx, opts)
+}
+
+// Iter returns an Iterator over the keys matching opts, like Trie.Iter.
+func (s *ShardedTrie) Iter(opts IterOptions) *Iterator {
+	return s.Snapshot().t.iter(opts)
+}
+
+// Range returns an Iterator over the keys in [from, to). An empty to means
+// no upper bound.
+func (s *ShardedTrie) Range(from, to string) *Iterator {
+	return s.Iter(IterOptions{From: from, To: to})
+}
+
+// Put inserts the given key/frequency pair into the shard of key.
+func (s *ShardedTrie) Put(key string, frequency uint) {
+	s.shard(key).Put(key, frequency)
+}
+
+// Inc increments the frequency of the given key.
+func (s *ShardedTrie) Inc(key string) {
+	s.shard(key).Inc(key)
+}
+
+// Add changes the frequency of an existing key by delta, like Trie.Add.
+func (s *ShardedTrie) Add(key string, delta int64) (uint, bool) {
+	return s.shard(key).Add(key, delta)
+}
+
+// Upsert is like Add but creates a missing key, like Trie.Upsert.
+func (s *ShardedTrie) Upsert(key string, delta int64) (uint, bool) {
+	return s.shard(key).Upsert(key, delta)
+}
+
+// Delete removes the key and reports whether it was present.
+func (s *ShardedTrie) Delete(key string) bool {
+	return s.shard(key).Delete(key)
+}
+
+// SetPayload sets the payload of an existing key, like Trie.SetPayload.
+func (s *ShardedTrie) SetPayload(key string, payload any) bool {
+	return s.shard(key).SetPayload(key, payload)
+}
+
+// Apply applies the batch in order, shard by shard. Each shard applies its
+// part under a single lock acquisition, but readers may see the parts of
+// different shards applied at different times.
+func (s *ShardedTrie) Apply(b *Batch) {
+	parts := make([]Batch, len(s.shards.tries))
+	for _, op := range b.ops {
+		i := s.shards.index(s.q.normalize(op.key))
+		parts[i].ops = append(parts[i].ops, op)
+	}
+	for i := range parts {
+		if parts[i].Len() > 0 {
+			s.shards.tries[i].Apply(&parts[i])
+		}
+	}
+}
+
+// WriteTo writes a binary snapshot of all shards to w, in the format of
+// Trie.WriteTo, so that it can be read by either.
+func (s *ShardedTrie) WriteTo(w io.Writer) (int64, error) {
+	rlock(s.shards.tries)
+	defer runlock(s.shards.tries)
+	return s.q.writeTo(w)
+}
+
+// Snapshot returns a read-only view of all shards as of the call, like
+// Trie.Snapshot. Writers wait while it is taken, not while it is read.
+func (s *ShardedTrie) Snapshot() *Snapshot {
+	for _, t := range s.shards.tries {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+	}
+	q := s.q.freeze()
+	q.shards = &shardSet{tries: make([]*Trie, len(s.shards.tries)), runes: s.shards.runes}
+	for i, t := range s.shards.tries {
+		q.shards.tries[i] = t.freeze()
+	}
+	return &Snapshot{t: q}
+}
+
+// ReadFrom replaces the contents of all shards, including their topK limit
+// and decay settings, with a snapshot read from r, written by either a Trie
+// or a ShardedTrie. On error the ShardedTrie is left unchanged.
+func (s *ShardedTrie) ReadFrom(r io.Reader) (int64, error) {
+	root, meta, n, err := readNodeSnapshot(r)
+	if err != nil {
+		return n, err
+	}
+
+	limit := root.topK.limit
+	roots := make([]*node, len(s.shards.tries))
+	for i := range roots {
+		roots[i] = newnode(limit)
+	}
+	root.eachEnd("", func(key string, n *node) {
+		path := roots[s.shards.index(key)].insert(key)
+		path[len(path)-1].copyEnd(n)
+	})
+	for _, root := range roots {
+		root.rebuildAllTopK()
+	}
+
+	for _, t := range s.shards.tries {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+	}
+	for i, t := range s.shards.tries {
+		t.load(roots[i], meta)
+	}
+	s.q.root, s.q.decay = newnode(limit), meta.decay
+	return n, nil
+}
+
+// roots returns the roots of the trees that may hold keys starting with
+// prefix: the Trie's own, or those of the shards it queries.
+func (t *Trie) roots(prefix string) []*node {
+	if t.shards == nil {
+		return []*node{t.root}
+	}
+	if i, ok := t.shards.holding(prefix); ok {
+		return []*node{t.shards.tries[i].root}
+	}
+	roots := make([]*node, len(t.shards.tries))
+	for i, shard := range t.shards.tries {
+		roots[i] = shard.root
+	}
+	return roots
+}
+
+// tokenRoots returns the roots of the token indexes of the Trie or of its
+// shards.
+func (t *Trie) tokenRoots() []*node {
+	if t.shards == nil {
+		if t.tokens == nil {
+			return nil
+		}
+		return []*node{t.tokens}
+	}
+	var roots []*node
+	for _, shard := range t.shards.tries {
+		if shard.tokens != nil {
+			roots = append(roots, shard.tokens)
+		}
+	}
+	return roots
+}
+
+// writeTo writes a snapshot of the Trie to w. The trees of the shards are
+// merged as they are written, in the format of a single tree.
+func (t *Trie) writeTo(w io.Writer) (int64, error) {
+	if t.shards == nil {
+		return t.root.writeTo(w, t.meta())
+	}
+
+	// Ordinals follow the order of keys, which the shards are merged in
+	ordinals := map[string]uint64{}
+	parts := make([]part, len(t.shards.tries))
+	for i, shard := range t.shards.tries {
+		parts[i] = part{n: shard.root}
+		if shard.root.isEnd {
+			ordinals[""] = 0
+		}
+	}
+	next := t.keys(IterOptions{}, true)
+	for n := next(); n != nil; n = next() {
+		ordinals[n.key] = uint64(len(ordinals))
+	}
+
+	limit := t.root.topK.limit
+	return encode(w, t.meta(), limit, ordinals, func(e *encoder) error {
+		return e.writeMerged(parts, "", "", limit)
+	})
+}
+
+// part is a node of one of several merged trees, together with its key.
+type part struct {
+	n   *node
+	key string
+}
+
+// writeMerged writes the node of the merged tree whose key is key, and
+// whose parent's is prefix. parts hold, for each tree with keys starting
+// with key, the node whose subtree holds exactly those keys.
+func (e *encoder) writeMerged(parts []part, prefix, key string, limit int) error {
+	label := key[len(prefix):]
+	e.uvarint(uint64(len(label)))
+	e.write([]byte(label))
+
+	var end *node
+	var items []topKHeapItem
+	for _, p := range parts {
+		if p.key == key && p.n.isEnd {
+			end = p.n
+		}
+		items = append(items, p.n.topK.items...)
+	}
+	e.writeEnd(end)
+	sortItems(items)
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	if err := e.writeTopK(key, items); err != nil {
+		return err
+	}
+
+	// Group the nodes below by the rune following key
+	groups := map[rune][]part{}
+	for _, p := range parts {
+		if p.key != key {
+			// key ends inside the edge to p
+			r := firstRune(p.key[len(key):])
+			groups[r] = append(groups[r], p)
+			continue
+		}
+		for r, child := range p.n.children {
+			groups[r] = append(groups[r], part{n: child, key: key + child.label})
+		}
+	}
+	runes := make([]rune, 0, len(groups))
+	for r := range groups {
+		runes = append(runes, r)
+	}
+	slices.Sort(runes)
+
+	e.uvarint(uint64(len(runes)))
+	for _, r := range runes {
+		group := groups[r]
+		// The child ends where the trees of the group part ways
+		child := group[0].key
+		for _, p := range group[1:] {
+			child = child[:commonPrefix(child, p.key)]
+		}
+		if err := e.writeMerged(group, key, child, limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rootOf returns the root of the tree holding key.
+func (t *Trie) rootOf(key string) *node {
+	if t.shards == nil {
+		return t.root
+	}
+	return t.shards.tries[t.shards.index(key)].root
+}
+
+// getTopK returns the top-K for prefix, in no particular order.
+func (t *Trie) getTopK(prefix string) []topKHeapItem {
+	if t.shards == nil {
+		return t.root.getTopK(prefix)
+	}
+	return mergeTopK(t.roots(prefix), prefix, t.root.topK.limit)
+}
+
+// getTokenPage returns the best n entries for prefix of the token index,
+// in order.
+func (t *Trie) getTokenPage(prefix string, n int) []topKHeapItem {
+	var items []topKHeapItem
+	for _, root := range t.tokenRoots() {
+		items = append(items, root.getPage(prefix, 0, n)...)
+	}
+	sortItems(items)
+	if len(items) > n {
+		items = items[:n]
+	}
+	return items
+}
+
+// mergeTopK returns the best limit of the top-K for prefix of all roots.
+func mergeTopK(roots []*node, prefix string, limit int) []topKHeapItem {
+	var items []topKHeapItem
+	for _, root := range roots {
+		items = append(items, root.getTopK(prefix)...)
+	}
+	sortItems(items)
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+func (t *Trie) getPage(prefix string, offset, limit int) []topKHeapItem {
+	if t.shards == nil {
+		return t.root.getPage(prefix, offset, limit)
+	}
+
+	// Every key of the page is on the first offset+limit of its shard
+	var items []topKHeapItem
+	for _, root := range t.roots(prefix) {
+		items = append(items, root.getPage(prefix, 0, offset+limit)...)
+	}
+	sortItems(items)
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+func (t *Trie) getFuzzyTopK(prefix string, maxEdits int) ([]topKHeapItem, []int, []int) {
+	decayed, scored := t.decay.enabled(), t.scorer != nil
+	if t.shards == nil {
+		return t.root.getFuzzyTopK(prefix, maxEdits, decayed, scored)
+	}
+
+	var items []topKHeapItem
+	var steps []int
+	matched := map[string]int{}
+	for _, shard := range t.shards.tries {
+		found, distances, ends := shard.root.getFuzzyTopK(prefix, maxEdits, decayed, scored)
+		items = append(items, found...)
+		steps = append(steps, distances...)
+		for i, item := range found {
+			matched[item.key] = ends[i]
+		}
+	}
+	sortPenalized(items, steps, editPenalty, decayed, scored)
+	if limit := t.root.topK.limit; len(items) > limit {
+		items, steps = items[:limit], steps[:limit]
+	}
+	ends := make([]int, len(items))
+	for i, item := range items {
+		ends[i] = matched[item.key]
+	}
+	return items, steps, ends
+}
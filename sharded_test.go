@@ -0,0 +1,215 @@
+package search_trie
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestShardedTrie_TopKPageOffset(t *testing.T) {
+	for _, trie := range []Index{NewTrie(3), NewShardedTrie(3, ShardOptions{Shards: 4})} {
+		trie.Put("iphone", 2)
+		trie.Put("ipad", 1)
+
+		for _, offset := range []int{2, math.MaxInt - 1, math.MaxInt} {
+			if res := trie.TopKPage("i", offset, 2); len(res) != 0 {
+				t.Errorf("%T.TopKPage(%d) = %v, want none", trie, offset, res)
+			}
+		}
+		expectKeyOrder(t, trie.TopKPage("i", 1, math.MaxInt), "ipad")
+	}
+}
+
+func TestShardedTrie_MatchesTrie(t *testing.T) {
+	words := []string{"iPhone", "ipad", "16", "pro", "Max", "айфон", "Айпад", "чехол", "i", "й"}
+	opts := []Option{
+		WithTokenIndex(),
+		WithNormalizer(DefaultNormalizer),
+		WithCorrections(Corrections{Layout: true, Translit: true}),
+		WithHighlights(),
+	}
+	rng := rand.New(rand.NewSource(1))
+
+	single := NewTrie(4, opts...)
+	sharded := []*ShardedTrie{
+		NewShardedTrie(4, ShardOptions{Shards: 8, Runes: 1}, opts...),
+		NewShardedTrie(4, ShardOptions{Shards: 8}, opts...),
+		NewShardedTrie(4, ShardOptions{Shards: 5, Runes: 3}, opts...),
+	}
+	each := func(fn func(Index)) {
+		fn(single)
+		for _, s := range sharded {
+			fn(s)
+		}
+	}
+	var b Batch
+	for i := 0; i < 500; i++ {
+		n := 1 + rng.Intn(3)
+		key := make([]string, n)
+		for j := range key {
+			key[j] = words[rng.Intn(len(words))]
+		}
+		k := strings.Join(key, " ")
+
+		switch rng.Intn(5) {
+		case 0, 1:
+			freq := uint(rng.Intn(100))
+			each(func(t Index) { t.Put(k, freq) })
+		case 2:
+			each(func(t Index) { t.Inc(k) })
+		case 3:
+			each(func(t Index) { t.Delete(k) })
+		case 4:
+			b.Upsert(k, int64(rng.Intn(20)-5))
+		}
+	}
+	single.Apply(&b)
+	for _, s := range sharded {
+		s.Apply(&b)
+		expectSameResults(t, single, s)
+	}
+
+	// Snapshots move between both kinds of tries
+	var buf bytes.Buffer
+	for _, s := range sharded {
+		buf.Reset()
+		if _, err := s.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		loaded := NewTrie(4, opts...)
+		if _, err := loaded.ReadFrom(&buf); err != nil {
+			t.Fatal(err)
+		}
+		expectSameResults(t, single, loaded)
+		expectExactTopK(t, loaded.root, "")
+	}
+
+	buf.Reset()
+	if _, err := single.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := NewShardedTrie(4, ShardOptions{Shards: 3}, opts...)
+	if _, err := reloaded.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expectSameResults(t, single, reloaded)
+}
+
+// expectSameResults checks that got answers queries as want does.
+func expectSameResults(t *testing.T, want, got Reader) {
+	t.Helper()
+	for _, q := range []string{"i", "I", "ip", "iph", "a", "айф", "fq", "16", "pr", "й", "чехол 16"} {
+		compare := func(name string, want, got []Result) {
+			t.Helper()
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("%s(%q) = %v, want %v", name, q, got, want)
+			}
+		}
+		compare("TopK", want.TopK(q), got.TopK(q))
+		compare("TopKPage", want.TopKPage(q, 2, 5), got.TopKPage(q, 2, 5))
+		compare("FuzzyTopK", want.FuzzyTopK(q, 1), got.FuzzyTopK(q, 1))
+		compare("Complete", want.Complete(q), got.Complete(q))
+		compare("Complete", want.Complete(q+" "), got.Complete(q+" "))
+	}
+
+	for _, prefix := range []string{"", "i", "ip", "ай"} {
+		opts := TraverseOptions{Prefix: prefix, Ordered: true}
+		var w, g []Result
+		for r := range want.TraverseContext(context.Background(), opts) {
+			w = append(w, r)
+		}
+		for r := range got.TraverseContext(context.Background(), opts) {
+			g = append(g, r)
+		}
+		if !reflect.DeepEqual(w, g) {
+			t.Errorf("TraverseContext(%+v) = %v, want %v", opts, g, w)
+		}
+	}
+}
+
+func TestShardedTrie_Iter(t *testing.T) {
+	trie := NewShardedTrie(5, ShardOptions{Shards: 4})
+	for i := 0; i < 100; i++ {
+		trie.Put(fmt.Sprintf("key %02d", i), uint(i))
+	}
+
+	var keys []string
+	it := trie.Range("key 10", "key 15")
+	for it.Next() {
+		keys = append(keys, it.Result().Key)
+	}
+	expected := []string{"key 10", "key 11", "key 12", "key 13", "key 14"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Range = %v, want %v", keys, expected)
+	}
+}
+
+func TestShardedTrie_Concurrent(t *testing.T) {
+	trie := NewShardedTrie(3, ShardOptions{Shards: 4}, WithTokenIndex())
+	keys := []string{"iphone", "ipad", "iphone 16", "macbook", "айфон", "айфон 16"}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := keys[(w+i)%len(keys)]
+				trie.Upsert(key, 1)
+				trie.TopK(key[:1])
+				trie.Complete("16 " + key[:1])
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var total uint
+	for r := range trie.Traverse() {
+		total += r.Frequency
+	}
+	if total != 8*200 {
+		t.Errorf("total frequency %d, want %d", total, 8*200)
+	}
+}
+
+func BenchmarkShardedTrie_GetTopKAndIncParallel(b *testing.B) {
+	tests := []struct {
+		name    string
+		topK    int
+		numKeys int
+	}{
+		{name: "Small dataset", topK: 5, numKeys: 1000},
+		{name: "Medium dataset", topK: 10, numKeys: 10000},
+		{name: "Large dataset", topK: 20, numKeys: 100000},
+	}
+
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			b.ReportAllocs()
+			// Keys all start with "key-", so shard by the digits after it
+			trie := NewShardedTrie(tt.topK, ShardOptions{Runes: 6})
+
+			keys := generateRandomKeys(tt.numKeys)
+			for _, key := range keys {
+				trie.Put(key, 1)
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if rand.Intn(10) <= 2 {
+						_ = trie.TopK(keys[rand.Intn(len(keys))][:2])
+					} else {
+						trie.Inc(keys[rand.Intn(len(keys))])
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package search_trie
+
+import (
+	"context"
+	"io"
+)
+
+// Snapshot is a read-only view of a Trie as of the time it was taken,
+// unaffected by later writes. Taking one copies nothing: the Trie shares
+// its nodes with the Snapshot and copies those it changes afterwards, each
+// once. A Snapshot is safe for concurrent use and needs no lock to read.
+type Snapshot struct {
+	t *Trie
+}
+
+var _ Reader = (*Snapshot)(nil)
+
+// Snapshot returns a read-only view of the Trie as of the call, for long
+// reads such as exports that should neither block writers nor see them.
+func (t *Trie) Snapshot() *Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &Snapshot{t: t.freeze()}
+}
+
+// TopK returns the top K keys for prefix, like Trie.TopK.
+func (s *Snapshot) TopK(key string) []Result {
+	return s.t.topK(key)
+}
+
+// TopKPage returns a page of the keys for prefix, like Trie.TopKPage.
+func (s *Snapshot) TopKPage(key string, offset, limit int) []Result {
+	return s.t.topKPage(key, offset, limit)
+}
+
+// FuzzyTopK returns the top K keys close to prefix, like Trie.FuzzyTopK.
+func (s *Snapshot) FuzzyTopK(prefix string, maxEdits int) []Result {
+	return s.t.fuzzyTopK(prefix, maxEdits)
+}
+
+// Complete returns the top K keys containing the words of query, like
+// Trie.Complete.
+func (s *Snapshot) Complete(query string) []Result {
+	return s.t.complete(query)
+}
+
+// Has checks the snapshot has the key.
+func (s *Snapshot) Has(key string) bool {
+	key = s.t.normalize(key)
+	return s.t.rootOf(key).has(key)
+}
+
+// Traverse returns all keys of the snapshot. The channel must be drained;
+// use TraverseContext to stop early.
+func (s *Snapshot) Traverse() <-chan Result {
+	return s.TraverseContext(context.Background(), TraverseOptions{})
+}
+
+// TraverseContext returns the keys of the snapshot, like
+// Trie.TraverseContext.
+func (s *Snapshot) TraverseContext(ctx context.Context, opts TraverseOptions) <-chan Result {
+	return s.t.traverse(ctx, opts)
+}
+
+// Iter returns an Iterator over the keys matching opts, like Trie.Iter.
+func (s *Snapshot) Iter(opts IterOptions) *Iterator {
+	return s.t.iter(opts)
+}
+
+// Range returns an Iterator over the keys in [from, to). An empty to means
+// no upper bound.
+func (s *Snapshot) Range(from, to string) *Iterator {
+	return s.Iter(IterOptions{From: from, To: to})
+}
+
+// WriteTo writes a binary snapshot of the keys to w, in the format of
+// Trie.WriteTo.
+func (s *Snapshot) WriteTo(w io.Writer) (int64, error) {
+	return s.t.writeTo(w)
+}
@@ -0,0 +1,152 @@
+package search_trie
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTrie_Snapshot(t *testing.T) {
+	trie := NewTrie(3)
+	trie.Put("iphone", 30)
+	trie.Put("ipad", 20)
+	trie.Put("macbook", 10)
+
+	snap := trie.Snapshot()
+	trie.Inc("ipad")
+	trie.Put("ipod", 50)
+	trie.Delete("macbook")
+
+	expected := []Result{
+		{Key: "iphone", Frequency: 30, Score: 30},
+		{Key: "ipad", Frequency: 20, Score: 20},
+	}
+	if got := snap.TopK("i"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("TopK = %v, want %v", got, expected)
+	}
+	if !snap.Has("macbook") || snap.Has("ipod") {
+		t.Errorf("Has(macbook), Has(ipod) = %v, %v, want true, false", snap.Has("macbook"), snap.Has("ipod"))
+	}
+
+	var keys []string
+	for it := snap.Range("", ""); it.Next(); {
+		keys = append(keys, it.Result().Key)
+	}
+	if expected := []string{"ipad", "iphone", "macbook"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Range = %v, want %v", keys, expected)
+	}
+
+	expected = []Result{
+		{Key: "ipod", Frequency: 50, Score: 50},
+		{Key: "iphone", Frequency: 30, Score: 30},
+		{Key: "ipad", Frequency: 21, Score: 21},
+	}
+	if got := trie.TopK("i"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Trie TopK = %v, want %v", got, expected)
+	}
+}
+
+func TestTrie_SnapshotModel(t *testing.T) {
+	words := []string{"iPhone", "ipad", "16", "pro", "айфон", "Айпад", "i"}
+	opts := []Option{WithTokenIndex(), WithNormalizer(DefaultNormalizer), WithHighlights()}
+	rng := rand.New(rand.NewSource(1))
+
+	type snapshotter interface {
+		Index
+		Snapshot() *Snapshot
+		WriteTo(w io.Writer) (int64, error)
+	}
+	tries := []snapshotter{
+		NewTrie(3, opts...),
+		NewTrie(3, append(opts, WithCopyOnWrite(0))...),
+		NewShardedTrie(3, ShardOptions{Shards: 4, Runes: 1}, opts...),
+	}
+	load := func(w io.WriterTo) *Trie {
+		var buf bytes.Buffer
+		if _, err := w.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		loaded := NewTrie(3, opts...)
+		if _, err := loaded.ReadFrom(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return loaded
+	}
+
+	type taken struct {
+		snap *Snapshot
+		want *Trie // loaded from the Trie when snap was taken
+	}
+	var snaps []taken
+	for i := 0; i < 400; i++ {
+		n := 1 + rng.Intn(2)
+		key := make([]string, n)
+		for j := range key {
+			key[j] = words[rng.Intn(len(words))]
+		}
+		k := strings.Join(key, " ")
+
+		op, freq := rng.Intn(4), uint(rng.Intn(100))
+		for _, trie := range tries {
+			switch op {
+			case 0, 1:
+				trie.Put(k, freq)
+			case 2:
+				trie.Inc(k)
+			case 3:
+				trie.Delete(k)
+			}
+			if i%40 == 0 {
+				snaps = append(snaps, taken{snap: trie.Snapshot(), want: load(trie)})
+			}
+		}
+	}
+
+	for i, s := range snaps {
+		expectSameResults(t, s.want, s.snap)
+		expectSameResults(t, s.want, load(s.snap))
+		if s.snap.t.shards == nil {
+			expectExactTopK(t, s.snap.t.root, "")
+		}
+		if t.Failed() {
+			t.Fatalf("snapshot %d", i)
+		}
+	}
+}
+
+func TestTrie_SnapshotConcurrent(t *testing.T) {
+	trie := NewTrie(3)
+	keys := []string{"iphone", "ipad", "iphone 16", "macbook", "айфон"}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			trie.Upsert(keys[i%len(keys)], 1)
+		}
+	}()
+
+	// Every snapshot holds a prefix of the writes
+	total := func(snap *Snapshot) uint {
+		var n uint
+		for r := range snap.Traverse() {
+			n += r.Frequency
+		}
+		return n
+	}
+	var last uint
+	for i := 0; i < 100; i++ {
+		n := total(trie.Snapshot())
+		if n < last {
+			t.Fatalf("snapshot has %d writes after one with %d", n, last)
+		}
+		last = n
+	}
+	<-done
+	if n := total(trie.Snapshot()); n != 1000 {
+		t.Errorf("last snapshot has %d writes, want 1000", n)
+	}
+}
@@ -0,0 +1,171 @@
+package search_trie
+
+import "strings"
+
+// The token index is a second radix tree holding, for every word starting
+// past the beginning of a key, the key rotated to start at that word:
+//
+//	"iphone 16 pro" -> "16 pro\x00iphone ", "pro\x00iphone 16 "
+//
+// The rest of the key follows a zero byte so that every entry is unique,
+// and is ranked like the key itself. Keys containing a zero byte are not
+// indexed. Like any key, an entry is kept once, by its terminal node, and
+// the labels inserted for it are cut from that copy. The rotation cannot
+// share the bytes of the key itself, so the index costs a copy of every
+// key for each of its later words.
+const tokenSep = "\x00"
+
+// WithTokenIndex lets TopK also match prefixes at the start of any word of
+// a key, so that "pro max" finds "iphone 16 pro max". Such matches rank
+// below the keys starting with the prefix. The index is kept in memory and
+// rebuilt on load. It holds a copy of every key for each of its later
+// words, so a key of n words takes about n times its memory.
+func WithTokenIndex() Option {
+	return func(o *options) {
+		o.tokens = true
+	}
+}
+
+// tokenStarts returns the byte offsets of the words of key that start past
+// its beginning. A word starts at a letter or digit following any other
+// rune.
+func tokenStarts(key string) []int {
+	var starts []int
+	prev := true
+	for i, r := range key {
+		word := isWordRune(r)
+		if word && !prev {
+			starts = append(starts, i)
+		}
+		prev = word
+	}
+	return starts
+}
+
+// tokenEntries returns the keys of the token index entries of key.
+func tokenEntries(key string) []string {
+	if strings.Contains(key, tokenSep) {
+		return nil
+	}
+	var entries []string
+	for _, start := range tokenStarts(key) {
+		entries = append(entries, key[start:]+tokenSep+key[:start])
+	}
+	return entries
+}
+
+// tokenKey returns the key a token index entry stands for and the byte
+// offset of the matched word in it.
+func tokenKey(entry string) (string, int) {
+	i := strings.Index(entry, tokenSep)
+	head := entry[i+len(tokenSep):]
+	return head + entry[:i], len(head)
+}
+
+// reindex brings the token index entries of key in line with the key's
+// state in the Trie after a write.
+func (t *Trie) reindex(key string) {
+	if t.tokens == nil {
+		return
+	}
+
+	curr, full := t.root.locate(key)
+	if curr == nil || full != key || !curr.isEnd {
+		for _, entry := range tokenEntries(key) {
+			t.tokens.delete(entry)
+		}
+		return
+	}
+	for _, entry := range tokenEntries(key) {
+		t.tokens.mirror(entry, curr)
+	}
+}
+
+// rebuildTokens rebuilds the token index from scratch.
+func (t *Trie) rebuildTokens() {
+	if t.tokens == nil {
+		return
+	}
+
+	t.tokens = newnode(t.root.topK.limit)
+	t.root.eachEnd("", func(key string, n *node) {
+		for _, entry := range tokenEntries(key) {
+			t.tokens.mirror(entry, n)
+		}
+	})
+}
+
+// eachEnd calls fn for every terminal node of the subtree of the node,
+// whose key is prefix.
+func (root *node) eachEnd(prefix string, fn func(key string, n *node)) {
+	if root.isEnd {
+		fn(prefix, root)
+	}
+	for _, child := range root.children {
+		child.eachEnd(prefix+child.label, fn)
+	}
+}
+
+// mirror makes key a terminal ranked like src and repairs the top-K along
+// its path.
+func (root *node) mirror(key string, src *node) {
+	path := root.insert(key)
+	curr := path[len(path)-1]
+	old, existed := curr.item(), curr.isEnd
+
+	curr.end(key)
+	curr.frequency = src.frequency
+	curr.weight = src.weight
+	curr.updated = src.updated
+	curr.score = src.score
+	curr.payload = src.payload
+
+	item := curr.item()
+	if !existed {
+		for _, n := range path {
+			n.updateTopK(item)
+		}
+		return
+	}
+	rerank(path, old, item)
+}
+
+// appendTokenMatches fills items, the completions of prefix, up to the
+// topK limit with keys having a later word that starts with prefix. It
+// returns the byte offset of the matched word of every item, zero for the
+// items given.
+func (t *Trie) appendTokenMatches(prefix string, items []topKHeapItem) ([]topKHeapItem, []int) {
+	limit := t.root.topK.limit
+	offsets := make([]int, len(items))
+	if t.tokens == nil || len(items) >= limit || strings.Contains(prefix, tokenSep) {
+		return items, offsets
+	}
+
+	// A key has an entry for every matching word, so while they crowd out
+	// other keys, fetch twice as many entries
+	given := len(items)
+	for n := limit; ; n *= 2 {
+		items, offsets = items[:given], offsets[:given]
+		seen := map[string]bool{}
+		for _, item := range items {
+			seen[item.key] = true
+		}
+		matches := t.getTokenPage(prefix, n)
+		for _, item := range matches {
+			key, offset := tokenKey(item.key)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			item.key = key
+			items = append(items, item)
+			offsets = append(offsets, offset)
+			if len(items) == limit {
+				return items, offsets
+			}
+		}
+		if len(matches) < n {
+			return items, offsets
+		}
+	}
+}
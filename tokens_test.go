@@ -0,0 +1,179 @@
+package search_trie
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestTokenEntries(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected []string
+	}{
+		{"iphone", nil},
+		{"iphone 16 pro max 256", []string{"16 pro max 256\x00iphone ", "pro max 256\x00iphone 16 ", "max 256\x00iphone 16 pro ", "256\x00iphone 16 pro max "}},
+		{"телефон 16 про", []string{"16 про\x00телефон ", "про\x00телефон 16 "}},
+		{"iphone-16  (pro)", []string{"16  (pro)\x00iphone-", "pro)\x00iphone-16  ("}},
+		{" ipad ", []string{"ipad \x00 "}},
+		{"ipad\x00air", nil},
+	}
+
+	for _, tt := range tests {
+		entries := tokenEntries(tt.key)
+		if !reflect.DeepEqual(entries, tt.expected) {
+			t.Errorf("tokenEntries(%q) = %q, want %q", tt.key, entries, tt.expected)
+		}
+		for _, entry := range entries {
+			if key, offset := tokenKey(entry); key != tt.key || !strings.HasPrefix(entry, key[offset:]) {
+				t.Errorf("tokenKey(%q) = %q, %d, want %q", entry, key, offset, tt.key)
+			}
+		}
+	}
+}
+
+func TestTrie_TokenIndex(t *testing.T) {
+	trie := NewTrie(3, WithTokenIndex())
+	for key, freq := range map[string]uint{
+		"iphone 16 pro max 256": 1,
+		"iphone 16 pro":         28,
+		"pro case":              2,
+		"телефон 16 про":        30,
+		"айфон 16 про":          28,
+	} {
+		trie.Put(key, freq)
+	}
+
+	expectKeyOrder(t, trie.TopK("pro max"), "iphone 16 pro max 256")
+	expectKeyOrder(t, trie.TopK("про"), "телефон 16 про", "айфон 16 про")
+	// Keys starting with the prefix come first
+	expectKeyOrder(t, trie.TopK("pro"), "pro case", "iphone 16 pro", "iphone 16 pro max 256")
+
+	trie.Add("iphone 16 pro max 256", 99)
+	trie.Delete("pro case")
+	expectKeyOrder(t, trie.TopK("pro"), "iphone 16 pro max 256", "iphone 16 pro")
+
+	var buf bytes.Buffer
+	if _, err := trie.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	loaded := NewTrie(3, WithTokenIndex())
+	if _, err := loaded.ReadFrom(&buf); err != nil {
+		t.Fatalf("ReadFrom() error = %v", err)
+	}
+	expectKeyOrder(t, loaded.TopK("16"), "iphone 16 pro max 256", "телефон 16 про", "айфон 16 про")
+
+	// Entries are stored once, by their terminal node and its label
+	loaded.tokens.eachEnd("", func(entry string, n *node) {
+		if len(n.children) > 0 {
+			return
+		}
+		tail := unsafe.StringData(n.key[len(n.key)-len(n.label):])
+		if n.key != entry || unsafe.StringData(n.label) != tail {
+			t.Errorf("entry %q holds its own copy of its label %q", entry, n.label)
+		}
+	})
+}
+
+func TestTrie_TokenIndexRepeatedWord(t *testing.T) {
+	for _, trie := range []Index{
+		NewTrie(3, WithTokenIndex()),
+		NewShardedTrie(3, ShardOptions{Shards: 2}, WithTokenIndex()),
+	} {
+		trie.Put("iphone pro max pro", 30)
+		trie.Put("case pro pro", 20)
+		trie.Put("galaxy pro", 10)
+		trie.Put("pixel pro", 5)
+
+		// Every word of a key matches, but the key takes one place
+		expectKeyOrder(t, trie.TopK("pro"), "iphone pro max pro", "case pro pro", "galaxy pro")
+		expectKeyOrder(t, trie.TopK("p"), "pixel pro", "iphone pro max pro", "case pro pro")
+	}
+}
+
+func TestTrie_TokenIndexModel(t *testing.T) {
+	keys := []string{
+		"iphone", "iphone 16", "iphone 16 pro", "iphone 16 pro max", "pro max",
+		"ipad pro", "macbook pro", "16 pro", "айфон 16 про", "про 16",
+		"pro max pro", "iphone pro max pro",
+	}
+	prefixes := []string{"i", "16", "16 p", "pro", "pro m", "max", "про", "а"}
+	rng := rand.New(rand.NewSource(1))
+	trie := NewTrie(3, WithTokenIndex())
+	expected := map[string]uint{}
+
+	for i := 0; i < 2000; i++ {
+		key := keys[rng.Intn(len(keys))]
+		switch rng.Intn(4) {
+		case 0:
+			trie.Upsert(key, int64(rng.Intn(40)))
+		case 1:
+			trie.Inc(key)
+		case 2:
+			trie.Add(key, int64(rng.Intn(40)-20))
+		case 3:
+			trie.Delete(key)
+		}
+		expected = map[string]uint{}
+		for item := range trie.Traverse() {
+			expected[item.Key] = item.Frequency
+		}
+
+		for _, prefix := range prefixes {
+			want := bruteForceTokenTopK(expected, prefix, 3)
+			got := trie.TopK(prefix)
+			if len(got) != len(want) {
+				t.Fatalf("op %d: TopK(%q) = %v, want %q", i, prefix, got, want)
+			}
+			for j := range want {
+				if got[j].Key != want[j] {
+					t.Fatalf("op %d: TopK(%q) = %v, want %q", i, prefix, got, want)
+				}
+			}
+		}
+	}
+}
+
+func bruteForceTokenTopK(freqs map[string]uint, prefix string, k int) []string {
+	rank := func(keys []string) []string {
+		items := make([]topKHeapItem, len(keys))
+		for i, key := range keys {
+			items[i] = topKHeapItem{key: key, freq: freqs[key]}
+		}
+		sortItems(items)
+		out := make([]string, 0, k)
+		for _, item := range items {
+			if len(out) == k {
+				break
+			}
+			out = append(out, item.key)
+		}
+		return out
+	}
+
+	var direct, tokens []string
+	for key := range freqs {
+		if strings.HasPrefix(key, prefix) {
+			direct = append(direct, key)
+			continue
+		}
+		for _, start := range tokenStarts(key) {
+			if strings.HasPrefix(key[start:], prefix) {
+				tokens = append(tokens, key)
+				break
+			}
+		}
+	}
+
+	out := rank(direct)
+	for _, key := range rank(tokens) {
+		if len(out) == k {
+			break
+		}
+		out = append(out, key)
+	}
+	return out
+}
@@ -1,34 +1,338 @@
 package search_trie
 
+import (
+	"container/heap"
+	"math"
+	"slices"
+	"sort"
+	"unicode/utf8"
+)
+
 type topKHeapItem struct {
-	key  string
-	freq uint
+	key     string
+	freq    uint
+	score   float64
+	payload *payload // carried along so results need no lookup
+}
+
+// less reports whether item ranks below other: by score, which is zero
+// without decay or a Scorer, then by frequency, then shorter keys first,
+// then lexicographically. Distinct keys are never tied.
+func (item topKHeapItem) less(other topKHeapItem) bool {
+	if item.score != other.score {
+		return item.score < other.score
+	}
+	if item.freq != other.freq {
+		return item.freq < other.freq
+	}
+	if item.key == other.key {
+		return false
+	}
+	n, m := utf8.RuneCountInString(item.key), utf8.RuneCountInString(other.key)
+	if n != m {
+		return n > m
+	}
+	return item.key > other.key
 }
 
+// maxScan is the heap size up to which keys are found by scanning the
+// items, which beats hashing them for small heaps.
+const maxScan = 16
+
+// topKHeap is a min-heap of the best keys of a subtree. Heaps larger than
+// maxScan keep the position of every key in index. The positions are
+// shared with pos, in heap order, so that moving items does not rehash
+// their keys.
 type topKHeap struct {
 	items []topKHeapItem
+	pos   []*int
+	index map[string]*int
 	limit int
 }
 
+// best returns the highest ranked item of the heap, or nil if it is empty.
+func (h *topKHeap) best() *topKHeapItem {
+	if len(h.items) == 0 {
+		return nil
+	}
+	m := &h.items[0]
+	for i := range h.items[1:] {
+		if m.less(h.items[i+1]) {
+			m = &h.items[i+1]
+		}
+	}
+	return m
+}
+
+// indexOf returns the position of key in the heap, or -1.
+func (h *topKHeap) indexOf(key string) int {
+	if h.index != nil {
+		if p, ok := h.index[key]; ok {
+			return *p
+		}
+		return -1
+	}
+	for i, item := range h.items {
+		if item.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// offer adds item to the heap if it is not there yet and ranks among the
+// top K, evicting the lowest ranked key if needed.
+func (h *topKHeap) offer(item topKHeapItem) {
+	if h.indexOf(item.key) >= 0 {
+		return
+	}
+	if h.Len() < h.limit {
+		heap.Push(h, item)
+		return
+	}
+	if h.items[0].less(item) {
+		h.replace(0, item)
+	}
+}
+
+// set makes items, in any order, the content of the heap.
+func (h *topKHeap) set(items []topKHeapItem) {
+	h.items = items
+	h.pos, h.index = nil, nil
+	if len(items) > maxScan {
+		h.reindex()
+	}
+	heap.Init(h)
+}
+
+// clone returns a copy of the heap sharing nothing with it.
+func (h *topKHeap) clone() *topKHeap {
+	c := &topKHeap{items: slices.Clone(h.items), limit: h.limit}
+	if h.index != nil {
+		c.reindex()
+	}
+	return c
+}
+
+// replace puts item in place of the one at position i, which may hold
+// another key, and restores the heap order.
+func (h *topKHeap) replace(i int, item topKHeapItem) {
+	if h.index != nil && h.items[i].key != item.key {
+		delete(h.index, h.items[i].key)
+		h.index[item.key] = h.pos[i]
+	}
+	h.items[i] = item
+	heap.Fix(h, i)
+}
+
+func (h *topKHeap) reindex() {
+	positions := make([]int, len(h.items))
+	h.pos = make([]*int, len(h.items))
+	h.index = make(map[string]*int, len(h.items))
+	for i, item := range h.items {
+		positions[i] = i
+		h.pos[i] = &positions[i]
+		h.index[item.key] = h.pos[i]
+	}
+}
+
 func (h *topKHeap) Len() int {
 	return len(h.items)
 }
 
 func (h *topKHeap) Less(i, j int) bool {
-	return h.items[i].freq < h.items[j].freq
+	return h.items[i].less(h.items[j])
 }
 
 func (h *topKHeap) Swap(i, j int) {
 	h.items[i], h.items[j] = h.items[j], h.items[i]
+	if h.index != nil {
+		h.pos[i], h.pos[j] = h.pos[j], h.pos[i]
+		*h.pos[i], *h.pos[j] = i, j
+	}
 }
 
 func (h *topKHeap) Push(x interface{}) {
-	h.items = append(h.items, x.(topKHeapItem))
+	item := x.(topKHeapItem)
+	h.items = append(h.items, item)
+	switch {
+	case h.index != nil:
+		p := len(h.items) - 1
+		h.pos = append(h.pos, &p)
+		h.index[item.key] = &p
+	case len(h.items) > maxScan:
+		h.reindex()
+	}
 }
 
 func (h *topKHeap) Pop() interface{} {
 	old := h.items
-	item := old[0]
-	h.items = old[1:]
+	item := old[len(old)-1]
+	h.items = old[:len(old)-1]
+	if h.index != nil {
+		delete(h.index, item.key)
+		h.pos = h.pos[:len(h.pos)-1]
+	}
 	return item
 }
+
+// sortItems orders items from the highest ranked down.
+func sortItems(items []topKHeapItem) {
+	sort.Slice(items, func(i, j int) bool {
+		return items[j].less(items[i])
+	})
+}
+
+// sortPenalized orders items from the highest ranked down after lowering
+// the rank of each by steps[i] penalties, each dividing its frequency or
+// decayed weight by factor. With a Scorer, whose scores have no known
+// scale, fewer steps always rank first. steps is reordered along.
+func sortPenalized(items []topKHeapItem, steps []int, factor float64, decayed, scored bool) {
+	// Ranks are compared as base-2 logarithms of the penalized weights
+	penalty := math.Log2(factor)
+	rank := func(i int) float64 {
+		s := float64(steps[i])
+		switch {
+		case scored:
+			return -s
+		case decayed:
+			return items[i].score - penalty*s
+		}
+		return math.Log2(float64(items[i].freq)) - penalty*s
+	}
+
+	sort.Sort(penalized{items: items, steps: steps, rank: rank})
+}
+
+type penalized struct {
+	items []topKHeapItem
+	steps []int
+	rank  func(i int) float64
+}
+
+func (p penalized) Len() int {
+	return len(p.items)
+}
+
+func (p penalized) Less(i, j int) bool {
+	ri, rj := p.rank(i), p.rank(j)
+	if ri != rj {
+		return ri > rj
+	}
+	return p.items[j].less(p.items[i])
+}
+
+func (p penalized) Swap(i, j int) {
+	p.items[i], p.items[j] = p.items[j], p.items[i]
+	p.steps[i], p.steps[j] = p.steps[j], p.steps[i]
+}
+
+// collector gathers the n highest ranked keys of a subtree, skipping those
+// accept, if set, rejects. Subtrees are visited best first by their cached
+// top-K, and the walk stops once none can beat the current n-th best.
+type collector struct {
+	n      int
+	accept func(key string) bool
+	items  []topKHeapItem
+	full   bool
+	min    topKHeapItem
+}
+
+func (c *collector) add(item topKHeapItem) {
+	if c.full && item.less(c.min) {
+		return
+	}
+	c.items = append(c.items, item)
+	if len(c.items) == c.n && !c.full || len(c.items)-c.n >= c.n {
+		c.compact()
+	}
+}
+
+func (c *collector) compact() {
+	sortItems(c.items)
+	if len(c.items) >= c.n {
+		c.items = c.items[:c.n]
+		c.full = true
+		c.min = c.items[c.n-1]
+	}
+}
+
+func (c *collector) walk(root *node) {
+	var q frontier
+	q.push(root)
+	for len(q) > 0 {
+		sub := q.pop()
+		if c.full && sub.best != nil && sub.best.less(c.min) {
+			// Every subtree left ranks lower
+			return
+		}
+		n := sub.n
+		if n.isEnd && (c.accept == nil || c.accept(n.key)) {
+			c.add(n.item())
+		}
+		for _, child := range n.children {
+			q.push(child)
+		}
+	}
+}
+
+// subtree is a node to visit, bounded by the best key of its top-K, or
+// unbounded if the top-K is empty.
+type subtree struct {
+	n    *node
+	best *topKHeapItem
+}
+
+// frontier is a binary max-heap of the subtrees left to visit, unbounded
+// first.
+type frontier []subtree
+
+func (f frontier) less(i, j int) bool {
+	if f[i].best == nil || f[j].best == nil {
+		return f[j].best == nil && f[i].best != nil
+	}
+	return f[i].best.less(*f[j].best)
+}
+
+func (f *frontier) push(n *node) {
+	*f = append(*f, subtree{n: n, best: n.topK.best()})
+
+	h := *f
+	for i := len(h) - 1; i > 0; {
+		parent := (i - 1) / 2
+		if !h.less(parent, i) {
+			break
+		}
+		h[parent], h[i] = h[i], h[parent]
+		i = parent
+	}
+}
+
+func (f *frontier) pop() subtree {
+	h := *f
+	top := h[0]
+	last := len(h) - 1
+	h[0] = h[last]
+	h = h[:last]
+	for i := 0; ; {
+		max, l, r := i, 2*i+1, 2*i+2
+		if l < len(h) && h.less(max, l) {
+			max = l
+		}
+		if r < len(h) && h.less(max, r) {
+			max = r
+		}
+		if max == i {
+			break
+		}
+		h[i], h[max] = h[max], h[i]
+		i = max
+	}
+	*f = h
+	return top
+}
+
+func (c *collector) result() []topKHeapItem {
+	c.compact()
+	return c.items
+}
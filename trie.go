@@ -1,67 +1,360 @@
 package search_trie
 
 import (
-	"sort"
+	"context"
+	"math"
 	"sync"
+	"time"
 )
 
+// Result is a key stored in the Trie together with its frequency. More
+// fields may be added over time, so build it with keyed literals.
+type Result struct {
+	// Key is the key as written, or its spelling written most for tries
+	// created WithNormalizer.
+	Key       string
+	Frequency uint
+	// Score is the score of Key for tries created WithScorer, the decayed
+	// popularity of Key at the time of the query for tries created
+	// WithDecay, and Frequency otherwise.
+	Score float64
+	// Distance is the number of edits between the query and the matched
+	// prefix of Key. It is zero for exact matches.
+	Distance int
+	// Correction is the prefix Key was found by for keys found through
+	// WithCorrections, and empty for keys matching the query as typed.
+	Correction string
+	// Highlights are the segments of Key matched by the query, in order,
+	// for tries created WithHighlights.
+	Highlights []Span
+
+	payload *payload
+}
+
+// Reader is the read surface of a Trie.
+type Reader interface {
+	TopK(key string) []Result
+	TopKPage(key string, offset, limit int) []Result
+	FuzzyTopK(prefix string, maxEdits int) []Result
+	Complete(query string) []Result
+	Has(key string) bool
+	Traverse() <-chan Result
+	TraverseContext(ctx context.Context, opts TraverseOptions) <-chan Result
+}
+
+// Writer is the write surface of a Trie.
+type Writer interface {
+	Put(key string, frequency uint)
+	Inc(key string)
+	Add(key string, delta int64) (uint, bool)
+	Upsert(key string, delta int64) (uint, bool)
+	Delete(key string) bool
+}
+
+// Index is the read/write surface of a Trie, for callers that want to
+// depend on an abstraction.
+type Index interface {
+	Reader
+	Writer
+}
+
+var _ Index = (*Trie)(nil)
+
 type Trie struct {
-	mu   sync.RWMutex
-	root *node
+	mu          sync.RWMutex
+	root        *node
+	log         *wal
+	decay       decay
+	scorer      Scorer
+	normalizer  Normalizer
+	corrections Corrections
+	tokens      *node // token index, nil unless enabled
+	highlights  bool
+	shards      *shardSet // shards queried in place of root, for a ShardedTrie
+	cow         *cow      // nil unless created WithCopyOnWrite
+	gen         uint64    // generation of the nodes writers may change in place
+	now         func() time.Time
 }
 
 // NewTrie creates a new Trie with the given topK limit.
-func NewTrie(topK int) *Trie {
-	return &Trie{root: newnode(topK)}
+func NewTrie(topK int, opts ...Option) *Trie {
+	o := options{now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	t := &Trie{
+		root:        newnode(topK),
+		scorer:      o.scorer,
+		normalizer:  o.normalizer,
+		corrections: o.corrections,
+		highlights:  o.highlights,
+		now:         o.now,
+	}
+	if o.tokens {
+		t.tokens = newnode(topK)
+	}
+	if o.halfLife > 0 {
+		t.decay = decay{halfLife: o.halfLife, epoch: o.now()}
+	}
+	if o.cow {
+		t.cow = &cow{interval: o.publish}
+		t.publishNow()
+	}
+	return t
+}
+
+// TopK returns the top K most frequent words for prefix, the most popular
+// ones for tries created WithDecay, or the best scored ones for tries
+// created WithScorer. Tries created WithCorrections fill up short results
+// with completions of the prefix typed in the other keyboard layout or
+// transliterated.
+func (t *Trie) TopK(key string) []Result {
+	r, done := t.read() // Блокируем чтение
+	defer done()
+	return r.topK(key)
 }
 
-// TopK returns the top K most frequent words for prefix.
-func (t *Trie) TopK(key string) []nodeInfo {
+func (t *Trie) topK(key string) []Result {
+	key = t.normalize(key)
 	if key == "" {
 		return nil
 	}
 
-	t.mu.RLock() // Блокируем чтение
-	defer t.mu.RUnlock()
+	topK := append([]topKHeapItem(nil), t.getTopK(key)...)
+	sortItems(topK)
+	topK, corrections := t.correct(key, topK)
+	topK, offsets := t.appendTokenMatches(key, topK)
 
-	topK := t.root.getTopK(key)
-	out := make([]nodeInfo, len(topK))
-	for i, item := range topK {
-		out[i] = nodeInfo{
-			Key:       item.key,
-			Frequency: item.freq,
+	out := t.toResults(topK)
+	for i := range out {
+		matched := key
+		if i < len(corrections) && corrections[i] != "" {
+			out[i].Correction = corrections[i]
+			matched = corrections[i]
 		}
+		start := offsets[i]
+		t.highlight(&out[i], topK[i].key, []byteSpan{{start, start + len(matched)}})
 	}
+	return out
+}
 
-	sort.Slice(out, func(i, j int) bool {
-		return out[i].Frequency > out[j].Frequency
-	})
+// TopKPage returns up to limit of the most frequent words for prefix,
+// skipping the first offset of them. Pages that fit in the construction-time
+// K are served from the cached top-K; deeper pages walk the prefix subtree.
+func (t *Trie) TopKPage(key string, offset, limit int) []Result {
+	r, done := t.read()
+	defer done()
+	return r.topKPage(key, offset, limit)
+}
 
+func (t *Trie) topKPage(key string, offset, limit int) []Result {
+	key = t.normalize(key)
+	if key == "" || offset < 0 || limit <= 0 {
+		return nil
+	}
+	if limit > math.MaxInt-offset {
+		// So that offset+limit does not overflow
+		limit = math.MaxInt - offset
+	}
+	items := t.getPage(key, offset, limit)
+	out := t.toResults(items)
+	for i := range out {
+		t.highlight(&out[i], items[i].key, []byteSpan{{0, len(key)}})
+	}
 	return out
 }
 
+// FuzzyTopK returns the top K words starting with any string within maxEdits
+// insertions, deletions, substitutions or transpositions of prefix. Each
+// edit lowers a candidate's rank as if its frequency were divided by 4. With
+// a Scorer, whose scores have no known scale, closer matches rank first.
+func (t *Trie) FuzzyTopK(prefix string, maxEdits int) []Result {
+	r, done := t.read()
+	defer done()
+	return r.fuzzyTopK(prefix, maxEdits)
+}
+
+func (t *Trie) fuzzyTopK(prefix string, maxEdits int) []Result {
+	prefix = t.normalize(prefix)
+	if prefix == "" {
+		return nil
+	}
+	if maxEdits < 0 {
+		maxEdits = 0
+	}
+
+	items, distances, ends := t.getFuzzyTopK(prefix, maxEdits)
+	out := t.toResults(items)
+	for i := range out {
+		out[i].Distance = distances[i]
+		t.highlight(&out[i], items[i].key, []byteSpan{{0, ends[i]}})
+	}
+	return out
+}
+
+func (t *Trie) toResults(items []topKHeapItem) []Result {
+	now := t.queryTime()
+	out := make([]Result, len(items))
+	for i, item := range items {
+		out[i] = t.toResult(item, now)
+	}
+	return out
+}
+
+// queryTime returns the time decayed popularity is read at, for tries
+// created WithDecay.
+func (t *Trie) queryTime() time.Time {
+	if t.decay.enabled() && t.scorer == nil {
+		return t.now()
+	}
+	return time.Time{}
+}
+
+// toResult returns item as a Result, with its popularity at now for tries
+// created WithDecay.
+func (t *Trie) toResult(item topKHeapItem, now time.Time) Result {
+	r := Result{
+		Key:       t.display(item.key),
+		Frequency: item.freq,
+		Score:     float64(item.freq),
+		payload:   item.payload,
+	}
+	switch {
+	case t.scorer != nil:
+		r.Score = item.score
+	case t.decay.enabled():
+		r.Score = t.decay.popularity(item.score, now)
+	}
+	return r
+}
+
 // Has checks trie has the key.
 func (t *Trie) Has(key string) bool {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	return t.root.has(key)
+	r, done := t.read()
+	defer done()
+	return r.root.has(r.normalize(key))
 }
 
-// Put inserts the given key/frequency pair into the Trie.
+// Put inserts the given key/frequency pair into the Trie, replacing the
+// frequency of an existing key even if the new one is lower.
 func (t *Trie) Put(key string, frequency uint) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	t.root.put(key, frequency)
+	t.lock()
+	defer t.unlock()
+	s := t.stamp()
+	t.logRecord(opPut, key, uint64(frequency), s.time)
+	form := key
+	key = t.normalize(key)
+	t.root.put(key, frequency, nil, s)
+	t.written(key, form, opPut, uint64(frequency))
 }
 
 // Inc increments the frequency of the given key.
 func (t *Trie) Inc(key string) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	t.root.inc(key)
+	t.lock()
+	defer t.unlock()
+	s := t.stamp()
+	t.logRecord(opInc, key, 0, s.time)
+	form := key
+	key = t.normalize(key)
+	t.root.inc(key, s)
+	t.written(key, form, opInc, 0)
+}
+
+// Add changes the frequency of an existing key by delta, saturating at zero,
+// and returns the new frequency. It reports false and does nothing if the
+// key is missing.
+func (t *Trie) Add(key string, delta int64) (uint, bool) {
+	t.lock()
+	defer t.unlock()
+	s := t.stamp()
+	t.logRecord(opAdd, key, uint64(delta), s.time)
+	form := key
+	key = t.normalize(key)
+	freq, ok := t.root.add(key, delta, false, s)
+	t.written(key, form, opAdd, uint64(delta))
+	return freq, ok
+}
+
+// Upsert is like Add but creates a missing key with frequency delta, or
+// zero if delta is negative. It reports whether the key existed.
+func (t *Trie) Upsert(key string, delta int64) (uint, bool) {
+	t.lock()
+	defer t.unlock()
+	s := t.stamp()
+	t.logRecord(opUpsert, key, uint64(delta), s.time)
+	form := key
+	key = t.normalize(key)
+	freq, existed := t.root.add(key, delta, true, s)
+	t.written(key, form, opUpsert, uint64(delta))
+	return freq, existed
 }
 
-// Traverse returns all keys in the Trie.
-func (t *Trie) Traverse() <-chan nodeInfo {
-	return t.root.traverse()
+// Delete removes the key from the Trie and reports whether it was present.
+func (t *Trie) Delete(key string) bool {
+	t.lock()
+	defer t.unlock()
+	t.logRecord(opDelete, key, 0, time.Time{})
+	key = t.normalize(key)
+	ok := t.root.delete(key)
+	t.written(key, key, opDelete, 0)
+	return ok
+}
+
+// written updates what derives from key after a write by op with value,
+// made under the spelling form.
+func (t *Trie) written(key, form string, op byte, value uint64) {
+	t.credit(key, form, op, value)
+	t.reindex(key)
+}
+
+// TraverseOptions restrict and order a traversal.
+type TraverseOptions struct {
+	// Prefix restricts the traversal to keys starting with it.
+	Prefix string
+	// Ordered yields keys in lexicographic order.
+	Ordered bool
+}
+
+// Traverse returns all keys in the Trie. The channel must be drained; use
+// TraverseContext to stop early.
+func (t *Trie) Traverse() <-chan Result {
+	return t.TraverseContext(context.Background(), TraverseOptions{})
+}
+
+// TraverseContext returns the keys of the Trie as of the call. Later writes
+// are not seen. Keys are read as they are sent from a version of the Trie
+// frozen by the call, so the Trie is not locked meanwhile. The channel is
+// closed once all keys are sent or ctx is done, so cancelling ctx releases
+// a consumer that stops reading early.
+func (t *Trie) TraverseContext(ctx context.Context, opts TraverseOptions) <-chan Result {
+	return t.frozen().traverse(ctx, opts)
+}
+
+// traverse streams the keys of the frozen Trie t matching opts.
+func (t *Trie) traverse(ctx context.Context, opts TraverseOptions) <-chan Result {
+	return traverse(ctx, t, opts, func(n *node, now time.Time) Result {
+		return t.toResult(n.item(), now)
+	})
+}
+
+// traverse sends the keys of the frozen Trie t matching opts, made into T
+// by result, on the returned channel until they run out or ctx is done,
+// then closes it.
+func traverse[T any](ctx context.Context, t *Trie, opts TraverseOptions, result func(n *node, now time.Time) T) <-chan T {
+	next := t.keys(IterOptions{Prefix: t.normalize(opts.Prefix)}, opts.Ordered)
+	now := t.queryTime()
+	out := make(chan T, 100)
+	go func() {
+		defer close(out)
+		for n := next(); n != nil; n = next() {
+			select {
+			case out <- result(n, now):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
 }
@@ -1,10 +1,17 @@
 package search_trie
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"math/rand"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
 	"testing"
 	"time"
+	"unsafe"
 )
 
 func TestTrie_PutAndTraverse(t *testing.T) {
@@ -76,12 +83,125 @@ func TestTrie_PutAndTraverse(t *testing.T) {
 	}
 }
 
+func TestTrie_TraverseContext(t *testing.T) {
+	testData := map[string]uint{
+		"iphone":        5,
+		"iphone 16":     3,
+		"iphone 16 pro": 7,
+		"ipad":          10,
+		"macbook":       4,
+		"айфон":         1,
+		"айпад":         2,
+	}
+
+	tests := []struct {
+		name        string
+		opts        TraverseOptions
+		expectedRes []string
+	}{
+		{
+			name:        "Ordered",
+			opts:        TraverseOptions{Ordered: true},
+			expectedRes: []string{"ipad", "iphone", "iphone 16", "iphone 16 pro", "macbook", "айпад", "айфон"},
+		},
+		{
+			name:        "Ordered prefix",
+			opts:        TraverseOptions{Prefix: "iph", Ordered: true},
+			expectedRes: []string{"iphone", "iphone 16", "iphone 16 pro"},
+		},
+		{
+			name:        "Prefix ends inside edge",
+			opts:        TraverseOptions{Prefix: "iphone 1", Ordered: true},
+			expectedRes: []string{"iphone 16", "iphone 16 pro"},
+		},
+		{
+			name:        "Russian prefix",
+			opts:        TraverseOptions{Prefix: "ай", Ordered: true},
+			expectedRes: []string{"айпад", "айфон"},
+		},
+		{
+			name:        "No matches",
+			opts:        TraverseOptions{Prefix: "sams", Ordered: true},
+			expectedRes: []string{},
+		},
+	}
+
+	trie := NewTrie(5)
+	for key, freq := range testData {
+		trie.Put(key, freq)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var keys []string
+			for item := range trie.TraverseContext(context.Background(), tt.opts) {
+				if item.Frequency != testData[item.Key] {
+					t.Errorf("key %q has frequency %d, want %d", item.Key, item.Frequency, testData[item.Key])
+				}
+				keys = append(keys, item.Key)
+			}
+			if fmt.Sprint(keys) != fmt.Sprint(tt.expectedRes) {
+				t.Errorf("TraverseContext() = %v, want %v", keys, tt.expectedRes)
+			}
+		})
+	}
+}
+
+func TestTrie_TraverseContextCancel(t *testing.T) {
+	trie := NewTrie(5)
+	for _, key := range generateRandomKeys(1000) {
+		trie.Put(key, 1)
+	}
+
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	out := trie.TraverseContext(ctx, TraverseOptions{})
+	<-out
+
+	// Writes during the traversal do not race with it
+	trie.Put("iphone", 1)
+	cancel()
+
+	for range out {
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("goroutines = %d after cancel, want %d", n, before)
+	}
+}
+
+func TestTrie_TraverseContextFrozen(t *testing.T) {
+	trie := NewTrie(5)
+	keys := []string{"ipad", "iphone", "iphone 16", "macbook", "айфон"}
+	for _, key := range keys {
+		trie.Put(key, 1)
+	}
+
+	out := trie.TraverseContext(context.Background(), TraverseOptions{Ordered: true})
+	got := []string{(<-out).Key}
+
+	// Writes during the traversal are not seen by it
+	for _, key := range keys {
+		trie.Delete(key)
+	}
+	trie.Put("iphone 15", 1)
+	for item := range out {
+		got = append(got, item.Key)
+	}
+	if !reflect.DeepEqual(got, keys) {
+		t.Errorf("TraverseContext() = %v, want %v", got, keys)
+	}
+}
+
 func TestTrie_TopK(t *testing.T) {
 	tests := []struct {
 		name        string
 		testData    map[string]uint
 		prefix      string
-		expectedRes []nodeInfo
+		expectedRes []Result
 	}{
 		{
 			name: "English words",
@@ -97,7 +217,7 @@ func TestTrie_TopK(t *testing.T) {
 				"macbook pro":           8,
 			},
 			prefix: "ip",
-			expectedRes: []nodeInfo{
+			expectedRes: []Result{
 				{Key: "iphone 16", Frequency: 45},
 				{Key: "ipad", Frequency: 35},
 				{Key: "iphone", Frequency: 30},
@@ -119,7 +239,7 @@ func TestTrie_TopK(t *testing.T) {
 				"макбук про":   8,
 			},
 			prefix: "ай",
-			expectedRes: []nodeInfo{
+			expectedRes: []Result{
 				{Key: "айфон 16", Frequency: 45},
 				{Key: "айпад", Frequency: 35},
 				{Key: "айфон", Frequency: 30},
@@ -141,7 +261,7 @@ func TestTrie_TopK(t *testing.T) {
 				"макбук про":    8,
 			},
 			prefix: "iph",
-			expectedRes: []nodeInfo{
+			expectedRes: []Result{
 				{Key: "iphone 16", Frequency: 45},
 				{Key: "iphone", Frequency: 30},
 				{Key: "iphone 16 pro", Frequency: 28},
@@ -161,7 +281,7 @@ func TestTrie_TopK(t *testing.T) {
 				"макбук про":    8,
 			},
 			prefix:      "sams",
-			expectedRes: []nodeInfo{},
+			expectedRes: []Result{},
 		},
 		{
 			name: "Empty Query",
@@ -177,7 +297,7 @@ func TestTrie_TopK(t *testing.T) {
 				"макбук про":    8,
 			},
 			prefix:      "",
-			expectedRes: []nodeInfo{},
+			expectedRes: []Result{},
 		},
 	}
 
@@ -212,6 +332,385 @@ func TestTrie_TopK(t *testing.T) {
 	}
 }
 
+func TestTrie_TopKPage(t *testing.T) {
+	testData := map[string]uint{
+		"iphone":                30,
+		"iphone 16":             45,
+		"iphone 16 pro":         28,
+		"iphone 16 pro max":     14,
+		"iphone 16 pro max 256": 1,
+		"ipad":                  35,
+		"ipad air":              20,
+		"macbook":               4,
+	}
+
+	tests := []struct {
+		name        string
+		prefix      string
+		offset      int
+		limit       int
+		expectedRes []string
+	}{
+		{
+			name:        "Limit below K",
+			prefix:      "ip",
+			offset:      0,
+			limit:       1,
+			expectedRes: []string{"iphone 16"},
+		},
+		{
+			name:        "First page",
+			prefix:      "ip",
+			offset:      0,
+			limit:       3,
+			expectedRes: []string{"iphone 16", "ipad", "iphone"},
+		},
+		{
+			name:        "Second page beyond K",
+			prefix:      "ip",
+			offset:      3,
+			limit:       3,
+			expectedRes: []string{"iphone 16 pro", "ipad air", "iphone 16 pro max"},
+		},
+		{
+			name:        "Last page",
+			prefix:      "ip",
+			offset:      6,
+			limit:       3,
+			expectedRes: []string{"iphone 16 pro max 256"},
+		},
+		{
+			name:        "Prefix ends inside edge",
+			prefix:      "iphone 16 p",
+			offset:      1,
+			limit:       5,
+			expectedRes: []string{"iphone 16 pro max", "iphone 16 pro max 256"},
+		},
+		{
+			name:        "Offset past end",
+			prefix:      "mac",
+			offset:      1,
+			limit:       3,
+			expectedRes: []string{},
+		},
+		{
+			name:        "No matches",
+			prefix:      "sams",
+			offset:      0,
+			limit:       3,
+			expectedRes: []string{},
+		},
+	}
+
+	trie := NewTrie(2)
+	for key, freq := range testData {
+		trie.Put(key, freq)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := trie.TopKPage(tt.prefix, tt.offset, tt.limit)
+			if len(res) != len(tt.expectedRes) {
+				t.Fatalf("TopKPage() = %v, want %v", res, tt.expectedRes)
+			}
+			for i, key := range tt.expectedRes {
+				if res[i].Key != key || res[i].Frequency != testData[key] {
+					t.Errorf("TopKPage() = %v, want %v", res[i], key)
+				}
+			}
+		})
+	}
+}
+
+func TestTrie_FuzzyTopK(t *testing.T) {
+	testData := map[string]uint{
+		"iphone":             30,
+		"iphone 16":          45,
+		"iphone 16 pro":      28,
+		"ipad":               35,
+		"macbook":            4,
+		"macbook air":        6,
+		"макбук":             12,
+		"макбук про":         8,
+		"айфон":              30,
+		"samsung galaxy s24": 2,
+	}
+
+	tests := []struct {
+		name        string
+		prefix      string
+		maxEdits    int
+		expectedRes []Result
+	}{
+		{
+			name:     "Transposition",
+			prefix:   "iphnoe",
+			maxEdits: 1,
+			expectedRes: []Result{
+				{Key: "iphone 16", Frequency: 45, Distance: 1},
+				{Key: "iphone", Frequency: 30, Distance: 1},
+				{Key: "iphone 16 pro", Frequency: 28, Distance: 1},
+			},
+		},
+		{
+			name:     "Russian deletion",
+			prefix:   "макбк",
+			maxEdits: 1,
+			expectedRes: []Result{
+				{Key: "макбук", Frequency: 12, Distance: 1},
+				{Key: "макбук про", Frequency: 8, Distance: 1},
+			},
+		},
+		{
+			name:     "Substitution",
+			prefix:   "makbook",
+			maxEdits: 1,
+			expectedRes: []Result{
+				{Key: "macbook air", Frequency: 6, Distance: 1},
+				{Key: "macbook", Frequency: 4, Distance: 1},
+			},
+		},
+		{
+			name:     "Exact matches rank above fuzzy ones",
+			prefix:   "ipad",
+			maxEdits: 2,
+			expectedRes: []Result{
+				{Key: "ipad", Frequency: 35, Distance: 0},
+				{Key: "iphone 16", Frequency: 45, Distance: 2},
+				{Key: "iphone", Frequency: 30, Distance: 2},
+				{Key: "iphone 16 pro", Frequency: 28, Distance: 2},
+			},
+		},
+		{
+			name:        "Too many edits",
+			prefix:      "samsnug galxay",
+			maxEdits:    1,
+			expectedRes: []Result{},
+		},
+	}
+
+	trie := NewTrie(5)
+	for key, freq := range testData {
+		trie.Put(key, freq)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := trie.FuzzyTopK(tt.prefix, tt.maxEdits)
+			if len(res) != len(tt.expectedRes) {
+				t.Fatalf("FuzzyTopK() = %v, want %v", res, tt.expectedRes)
+			}
+			for i, item := range tt.expectedRes {
+				if res[i].Key != item.Key || res[i].Frequency != item.Frequency || res[i].Distance != item.Distance {
+					t.Errorf("FuzzyTopK() = %v, want %v", res[i], item)
+				}
+			}
+		})
+	}
+}
+
+func TestTrie_FuzzyTopKEmptyKey(t *testing.T) {
+	trie := NewTrie(5)
+	trie.Put("", 100)
+	trie.Put("ab", 1)
+
+	res := trie.FuzzyTopK("a", 1)
+	if len(res) != 1 || res[0].Key != "ab" || res[0].Distance != 0 {
+		t.Errorf("FuzzyTopK() = %v, want only ab", res)
+	}
+}
+
+func TestTrie_Add(t *testing.T) {
+	testData := map[string]uint{
+		"iphone":        30,
+		"iphone 16":     45,
+		"iphone 16 pro": 28,
+		"ipad":          35,
+	}
+
+	tests := []struct {
+		name         string
+		key          string
+		delta        int64
+		upsert       bool
+		expectedFreq uint
+		expectedOk   bool
+		expectedRes  []Result
+	}{
+		{
+			name:         "Increase",
+			key:          "iphone 16 pro",
+			delta:        100,
+			expectedFreq: 128,
+			expectedOk:   true,
+			expectedRes: []Result{
+				{Key: "iphone 16 pro", Frequency: 128},
+				{Key: "iphone 16", Frequency: 45},
+			},
+		},
+		{
+			name:         "Decrease promotes next candidate",
+			key:          "iphone 16",
+			delta:        -40,
+			expectedFreq: 5,
+			expectedOk:   true,
+			expectedRes: []Result{
+				{Key: "ipad", Frequency: 35},
+				{Key: "iphone", Frequency: 30},
+			},
+		},
+		{
+			name:         "Saturates at zero",
+			key:          "ipad",
+			delta:        -1000,
+			expectedFreq: 0,
+			expectedOk:   true,
+			expectedRes: []Result{
+				{Key: "iphone 16", Frequency: 45},
+				{Key: "iphone", Frequency: 30},
+			},
+		},
+		{
+			name:         "Missing key",
+			key:          "ipod",
+			delta:        100,
+			expectedFreq: 0,
+			expectedOk:   false,
+			expectedRes: []Result{
+				{Key: "iphone 16", Frequency: 45},
+				{Key: "ipad", Frequency: 35},
+			},
+		},
+		{
+			name:         "Upsert missing key",
+			key:          "ipod",
+			delta:        100,
+			upsert:       true,
+			expectedFreq: 100,
+			expectedOk:   false,
+			expectedRes: []Result{
+				{Key: "ipod", Frequency: 100},
+				{Key: "iphone 16", Frequency: 45},
+			},
+		},
+		{
+			name:         "Upsert existing key",
+			key:          "iphone",
+			delta:        -10,
+			upsert:       true,
+			expectedFreq: 20,
+			expectedOk:   true,
+			expectedRes: []Result{
+				{Key: "iphone 16", Frequency: 45},
+				{Key: "ipad", Frequency: 35},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trie := NewTrie(2)
+			for key, freq := range testData {
+				trie.Put(key, freq)
+			}
+
+			add := trie.Add
+			if tt.upsert {
+				add = trie.Upsert
+			}
+			freq, ok := add(tt.key, tt.delta)
+			if freq != tt.expectedFreq || ok != tt.expectedOk {
+				t.Errorf("Add(%q, %d) = %d, %v, expected %d, %v", tt.key, tt.delta, freq, ok, tt.expectedFreq, tt.expectedOk)
+			}
+			if trie.Has(tt.key) != (tt.expectedOk || tt.upsert) {
+				t.Errorf("Has(%q) = %v after Add", tt.key, trie.Has(tt.key))
+			}
+
+			res := trie.TopK("ip")
+			if len(res) != len(tt.expectedRes) {
+				t.Fatalf("TopK() = %v, want %v", res, tt.expectedRes)
+			}
+			for i, item := range tt.expectedRes {
+				if res[i].Key != item.Key || res[i].Frequency != item.Frequency {
+					t.Errorf("TopK() = %v, want %v", res[i], item)
+				}
+			}
+		})
+	}
+}
+
+func TestTrie_Apply(t *testing.T) {
+	keys := []string{
+		"iphone", "iphone 16", "iphone 16 pro", "iphone 16 pro max", "ipad",
+		"ipad air", "macbook", "macbook pro", "айфон", "айфон 16", "айпад",
+	}
+	rng := rand.New(rand.NewSource(1))
+
+	for round := 0; round < 50; round++ {
+		sequential, batched := NewTrie(3), NewTrie(3)
+		for _, key := range keys[:5] {
+			sequential.Put(key, 10)
+			batched.Put(key, 10)
+		}
+
+		var b Batch
+		for i := 0; i < 30; i++ {
+			key := keys[rng.Intn(len(keys))]
+			switch rng.Intn(4) {
+			case 0:
+				freq := uint(rng.Intn(50))
+				sequential.Put(key, freq)
+				b.Put(key, freq)
+			case 1:
+				sequential.Inc(key)
+				b.Inc(key)
+			case 2:
+				delta := int64(rng.Intn(40) - 20)
+				sequential.Add(key, delta)
+				b.Add(key, delta)
+			case 3:
+				delta := int64(rng.Intn(40) - 20)
+				sequential.Upsert(key, delta)
+				b.Upsert(key, delta)
+			}
+		}
+		batched.Apply(&b)
+
+		expected := make(map[string]uint)
+		for item := range sequential.Traverse() {
+			expected[item.Key] = item.Frequency
+		}
+		expectKeys(t, batched, expected)
+
+		// Compare against a brute-force top-K over the final frequencies
+		for _, key := range keys {
+			runes := []rune(key)
+			for _, prefix := range []string{string(runes[:1]), string(runes[:2]), key} {
+				var want []uint
+				for k, freq := range expected {
+					if strings.HasPrefix(k, prefix) {
+						want = append(want, freq)
+					}
+				}
+				sort.Slice(want, func(i, j int) bool { return want[i] > want[j] })
+				if len(want) > 3 {
+					want = want[:3]
+				}
+
+				got := batched.TopK(prefix)
+				if len(want) != len(got) {
+					t.Fatalf("round %d: TopK(%q) = %v, want frequencies %v", round, prefix, got, want)
+				}
+				for i := range want {
+					if want[i] != got[i].Frequency {
+						t.Fatalf("round %d: TopK(%q) = %v, want frequencies %v", round, prefix, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
 func TestTrie_Has(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -281,45 +780,316 @@ func TestTrie_Has(t *testing.T) {
 	}
 }
 
-//BenchmarkTrie_GetTopK/English_words-8             301017              4525 ns/op             272 B/op          7 allocs/op
-//BenchmarkTrie_GetTopK/Russian_words-8             277951              4034 ns/op             304 B/op          9 allocs/op
-//BenchmarkTrie_Put/Small_dataset-8                 133527              9283 ns/op            1201 B/op         36 allocs/op
-//BenchmarkTrie_Put/Medium_dataset-8                 89562             12807 ns/op            1291 B/op         37 allocs/op
-//BenchmarkTrie_Put/Large_dataset-8                  74458             17335 ns/op            1493 B/op         41 allocs/op
-//BenchmarkTrie_Put/Small_topk-8                    109454             11641 ns/op            1470 B/op         42 allocs/op
-//BenchmarkTrie_Put/Medium_topk-8                    92978             13822 ns/op            1485 B/op         41 allocs/op
-//BenchmarkTrie_Put/Large_topk-8                     73536             17225 ns/op            1494 B/op         41 allocs/op
-//BenchmarkTrie_Inc/Small_dataset-8                 140379              9047 ns/op            1225 B/op         36 allocs/op
-//BenchmarkTrie_Inc/Medium_dataset-8                101518             12461 ns/op            1260 B/op         36 allocs/op
-//BenchmarkTrie_Inc/Large_dataset-8                  81650             16850 ns/op            1276 B/op         36 allocs/op
-//BenchmarkTrie_Inc/Small_topk-8                    114806             12618 ns/op            1336 B/op         38 allocs/op
-//BenchmarkTrie_Inc/Medium_topk-8                    97866             13421 ns/op            1295 B/op         37 allocs/op
-//BenchmarkTrie_Inc/Large_topk-8                     77398             16541 ns/op            1276 B/op         36 allocs/op
-//BenchmarkTrie_GetTopKParallel-8                   561360              2122 ns/op             146 B/op          5 allocs/op
-//BenchmarkTrie_PutParallel/Small_dataset-8                  91459             12926 ns/op            1203 B/op         36 allocs/op
-//BenchmarkTrie_PutParallel/Medium_dataset-8                 66752             17856 ns/op            1305 B/op         37 allocs/op
-//BenchmarkTrie_PutParallel/Large_dataset-8                  53194             23275 ns/op            1487 B/op         41 allocs/op
-//BenchmarkTrie_PutParallel/Small_topk-8                     78505             15391 ns/op            1463 B/op         42 allocs/op
-//BenchmarkTrie_PutParallel/Medium_topk-8                    65421             18760 ns/op            1477 B/op         41 allocs/op
-//BenchmarkTrie_PutParallel/Large_topk-8                     54554             23091 ns/op            1484 B/op         41 allocs/op
-//BenchmarkTrie_IncParallel/Small_dataset-8                  95036             12247 ns/op            1190 B/op         36 allocs/op
-//BenchmarkTrie_IncParallel/Medium_dataset-8                 73290             16931 ns/op            1230 B/op         36 allocs/op
-//BenchmarkTrie_IncParallel/Large_dataset-8                  58549             21922 ns/op            1263 B/op         36 allocs/op
-//BenchmarkTrie_IncParallel/Small_topk-8                     87006             14669 ns/op            1312 B/op         38 allocs/op
-//BenchmarkTrie_IncParallel/Medium_topk-8                    69993             17650 ns/op            1287 B/op         37 allocs/op
-//BenchmarkTrie_IncParallel/Large_topk-8                     57313             21858 ns/op            1263 B/op         36 allocs/op
-//BenchmarkTrie_GetTopKAndInc/Small_dataset-8               146946              8420 ns/op             919 B/op         27 allocs/op
-//BenchmarkTrie_GetTopKAndInc/Medium_dataset-8              111247             12673 ns/op             982 B/op         27 allocs/op
-//BenchmarkTrie_GetTopKAndInc/Large_dataset-8                92185             14468 ns/op            1082 B/op         27 allocs/op
-//BenchmarkTrie_GetTopKAndInc/Small_topk-8                  143139              9362 ns/op            1015 B/op         29 allocs/op
-//BenchmarkTrie_GetTopKAndInc/Medium_topk-8                 110716             11883 ns/op            1022 B/op         28 allocs/op
-//BenchmarkTrie_GetTopKAndInc/Large_topk-8                   95582             14251 ns/op            1082 B/op         27 allocs/op
-//BenchmarkTrie_GetTopKAndIncParallel/Small_dataset-8               109334             11160 ns/op             915 B/op         27 allocs/op
-//BenchmarkTrie_GetTopKAndIncParallel/Medium_dataset-8               76646             16896 ns/op             977 B/op         27 allocs/op
-//BenchmarkTrie_GetTopKAndIncParallel/Large_dataset-8                65320             19459 ns/op            1070 B/op         27 allocs/op
-//BenchmarkTrie_GetTopKAndIncParallel/Small_topk-8                  101413             12367 ns/op             999 B/op         28 allocs/op
-//BenchmarkTrie_GetTopKAndIncParallel/Medium_topk-8                  80700             16219 ns/op            1015 B/op         28 allocs/op
-//BenchmarkTrie_GetTopKAndIncParallel/Large_topk-8                   64881             19452 ns/op            1072 B/op         27 allocs/op
+func TestTrie_Delete(t *testing.T) {
+	tests := []struct {
+		name        string
+		testData    map[string]uint
+		key         string
+		prefix      string
+		expectedOk  bool
+		expectedRes []Result
+	}{
+		{
+			name: "Delete promotes next candidate",
+			testData: map[string]uint{
+				"ipad":          35,
+				"iphone 16 pro": 28,
+				"iphone":        30,
+				"iphone 16":     45,
+				"iphone 16 max": 14,
+				"iphone 256":    1,
+			},
+			key:        "iphone 16",
+			prefix:     "ip",
+			expectedOk: true,
+			expectedRes: []Result{
+				{Key: "ipad", Frequency: 35},
+				{Key: "iphone", Frequency: 30},
+				{Key: "iphone 16 pro", Frequency: 28},
+				{Key: "iphone 16 max", Frequency: 14},
+				{Key: "iphone 256", Frequency: 1},
+			},
+		},
+		{
+			name: "Delete leaf prunes path",
+			testData: map[string]uint{
+				"айфон":      30,
+				"айфон макс": 14,
+				"айпад":      35,
+			},
+			key:         "айфон макс",
+			prefix:      "айфон ",
+			expectedOk:  true,
+			expectedRes: []Result{},
+		},
+		{
+			name: "Delete prefix keeps descendants",
+			testData: map[string]uint{
+				"macbook":     4,
+				"macbook air": 6,
+				"macbook pro": 8,
+			},
+			key:        "macbook",
+			prefix:     "mac",
+			expectedOk: true,
+			expectedRes: []Result{
+				{Key: "macbook pro", Frequency: 8},
+				{Key: "macbook air", Frequency: 6},
+			},
+		},
+		{
+			name: "Delete missing key",
+			testData: map[string]uint{
+				"macbook":     4,
+				"macbook pro": 8,
+			},
+			key:        "macbook air",
+			prefix:     "mac",
+			expectedOk: false,
+			expectedRes: []Result{
+				{Key: "macbook pro", Frequency: 8},
+				{Key: "macbook", Frequency: 4},
+			},
+		},
+		{
+			name: "Delete non-terminal prefix",
+			testData: map[string]uint{
+				"macbook pro": 8,
+			},
+			key:        "macbook",
+			prefix:     "mac",
+			expectedOk: false,
+			expectedRes: []Result{
+				{Key: "macbook pro", Frequency: 8},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trie := NewTrie(5)
+
+			// Add keys and their frequencies to the Trie
+			for key, freq := range tt.testData {
+				trie.Put(key, 0) // Add the key with an initial value
+				for i := 0; i < int(freq); i++ {
+					trie.Inc(key) // Increment the frequency of the key
+				}
+			}
+
+			if ok := trie.Delete(tt.key); ok != tt.expectedOk {
+				t.Errorf("Delete(%q) = %v, expected %v", tt.key, ok, tt.expectedOk)
+			}
+			if trie.Has(tt.key) {
+				t.Errorf("Has(%q) = true after Delete", tt.key)
+			}
+
+			res := trie.TopK(tt.prefix)
+			if len(res) != len(tt.expectedRes) {
+				t.Fatalf("TopK() = %v, want %v", res, tt.expectedRes)
+			}
+			for i, item := range tt.expectedRes {
+				if res[i].Key != item.Key || res[i].Frequency != item.Frequency {
+					t.Errorf("TopK() = %v, want %v", res[i], tt.expectedRes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTrie_RadixLayout(t *testing.T) {
+	trie := NewTrie(5)
+	for _, key := range []string{"team", "test", "toast", "тест", "тесто"} {
+		trie.Put(key, 1)
+	}
+
+	// Split points are not keys
+	for _, key := range []string{"t", "te", "тес"} {
+		if trie.Has(key) {
+			t.Errorf("Has(%q) = true, expected false", key)
+		}
+	}
+	if res := trie.TopK("te"); len(res) != 2 {
+		t.Errorf("TopK(%q) = %v, want 2 results", "te", res)
+	}
+	if res := trie.TopK("тест"); len(res) != 2 {
+		t.Errorf("TopK(%q) = %v, want 2 results", "тест", res)
+	}
+
+	// Deleting keys collapses single-child chains back into one edge
+	trie.Delete("team")
+	trie.Delete("toast")
+	child := trie.root.children['t']
+	if child == nil || child.label != "test" || len(child.children) != 0 {
+		t.Errorf("expected a single %q edge, got %+v", "test", child)
+	}
+	trie.Delete("тест")
+	child = trie.root.children['т']
+	if child == nil || child.label != "тесто" || !child.isEnd {
+		t.Errorf("expected a single %q edge, got %+v", "тесто", child)
+	}
+}
+
+func TestTrie_TopKModel(t *testing.T) {
+	// Enough keys to outgrow the scanned heaps of maxScan keys
+	keys := []string{"ай", "айф", "айфон", "айпад"}
+	for _, a := range "abc" {
+		for _, b := range []string{"", "a", "b", "ab", "ba", "bab"} {
+			keys = append(keys, string(a)+b)
+		}
+	}
+	limits := []int{1, 2, 3, maxScan, maxScan + 4}
+	rng := rand.New(rand.NewSource(1))
+
+	for round := 0; round < 200; round++ {
+		trie := NewTrie(limits[rng.Intn(len(limits))])
+		for i := 0; i < 100; i++ {
+			// Keys come in fresh strings, as read from requests
+			key := strings.Clone(keys[rng.Intn(len(keys))])
+			switch rng.Intn(6) {
+			case 0, 1:
+				trie.Put(key, uint(rng.Intn(20)))
+			case 2:
+				trie.Inc(key)
+			case 3:
+				trie.Add(key, int64(rng.Intn(20)-10))
+			case 4:
+				trie.Upsert(key, int64(rng.Intn(20)-10))
+			case 5:
+				trie.Delete(key)
+			}
+			if i%10 == 9 {
+				var b Batch
+				for j := 0; j < 5; j++ {
+					b.Put(strings.Clone(keys[rng.Intn(len(keys))]), uint(rng.Intn(20)))
+				}
+				trie.Apply(&b)
+			}
+			expectExactTopK(t, trie.root, "")
+			if t.Failed() {
+				t.Fatalf("round %d, operation %d", round, i)
+			}
+		}
+
+		var buf bytes.Buffer
+		if _, err := trie.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		loaded := NewTrie(trie.root.topK.limit)
+		if _, err := loaded.ReadFrom(&buf); err != nil {
+			t.Fatal(err)
+		}
+		expectExactTopK(t, loaded.root, "")
+		if t.Failed() {
+			t.Fatalf("round %d, loaded", round)
+		}
+	}
+}
+
+// collect appends the keys of the subtree of the node, but the empty key,
+// to out.
+func (root *node) collect(out []topKHeapItem) []topKHeapItem {
+	if root.isEnd && root.key != "" {
+		out = append(out, root.item())
+	}
+	for _, child := range root.children {
+		out = child.collect(out)
+	}
+	return out
+}
+
+// expectExactTopK checks that the heap of every node of the subtree of n,
+// whose key is prefix, is ordered, indexed and holds its best keys.
+func expectExactTopK(t *testing.T, n *node, prefix string) {
+	t.Helper()
+	h := n.topK
+	for i := 1; i < h.Len(); i++ {
+		if h.Less(i, (i-1)/2) {
+			t.Errorf("heap of %q is not ordered: %v", prefix, h.items)
+			break
+		}
+	}
+	if h.index == nil && h.Len() > maxScan {
+		t.Errorf("heap of %q holds %d keys without an index", prefix, h.Len())
+	}
+	if h.index != nil {
+		for i, item := range h.items {
+			if p, ok := h.index[item.key]; !ok || *p != i || h.pos[i] != p || len(h.index) != h.Len() {
+				t.Errorf("heap of %q has index %v for items %v", prefix, h.index, h.items)
+				break
+			}
+		}
+	}
+
+	want := n.collect(nil)
+	if prefix == "" && n.isEnd {
+		want = append(want, n.item())
+	}
+	sortItems(want)
+	if len(want) > h.limit {
+		want = want[:h.limit]
+	}
+	got := append([]topKHeapItem(nil), h.items...)
+	sortItems(got)
+	if len(got) != len(want) || len(got) > 0 && !reflect.DeepEqual(got, want) {
+		t.Errorf("top-K of %q = %v, want %v", prefix, got, want)
+	}
+
+	if n.isEnd && n.key != prefix {
+		t.Errorf("node of %q holds key %q", prefix, n.key)
+	}
+	for _, item := range h.items {
+		// Heaps share the copy of the key kept by its terminal node
+		path := n.walk(item.key[len(prefix):])
+		if path == nil || unsafe.StringData(path[len(path)-1].key) != unsafe.StringData(item.key) {
+			t.Errorf("heap of %q holds its own copy of %q", prefix, item.key)
+		}
+	}
+
+	for _, child := range n.children {
+		expectExactTopK(t, child, prefix+child.label)
+	}
+}
+
+//BenchmarkTrie_GetTopK/English_words-8                1000000        1187 ns/op          224 B/op       4 allocs/op
+//BenchmarkTrie_GetTopK/Russian_words-8                1000000        1195 ns/op          224 B/op       4 allocs/op
+//BenchmarkTrie_Put/Small_dataset-8                     573711        2067 ns/op          325 B/op       6 allocs/op
+//BenchmarkTrie_Put/Medium_dataset-8                    363188        3964 ns/op          374 B/op       6 allocs/op
+//BenchmarkTrie_Put/Large_dataset-8                     363560        6481 ns/op          457 B/op       8 allocs/op
+//BenchmarkTrie_Put/Small_topk-8                        340545        5432 ns/op          497 B/op       9 allocs/op
+//BenchmarkTrie_Put/Medium_topk-8                       275300        6465 ns/op          490 B/op       8 allocs/op
+//BenchmarkTrie_Put/Large_topk-8                        263468        6801 ns/op          478 B/op       8 allocs/op
+//BenchmarkTrie_Inc/Small_dataset-8                     912453        1749 ns/op          356 B/op       6 allocs/op
+//BenchmarkTrie_Inc/Medium_dataset-8                    361000        3019 ns/op          388 B/op       6 allocs/op
+//BenchmarkTrie_Inc/Large_dataset-8                     296836        5469 ns/op          400 B/op       6 allocs/op
+//BenchmarkTrie_Inc/Small_topk-8                        274992        5663 ns/op          455 B/op       8 allocs/op
+//BenchmarkTrie_Inc/Medium_topk-8                       383040        4855 ns/op          417 B/op       7 allocs/op
+//BenchmarkTrie_Inc/Large_topk-8                        252158        5382 ns/op          401 B/op       6 allocs/op
+//BenchmarkTrie_GetTopKParallel-8                      2539122       488.3 ns/op           97 B/op       2 allocs/op
+//BenchmarkTrie_PutParallel/Small_dataset-8             483454        2608 ns/op          324 B/op       6 allocs/op
+//BenchmarkTrie_PutParallel/Medium_dataset-8            258061        4600 ns/op          376 B/op       6 allocs/op
+//BenchmarkTrie_PutParallel/Large_dataset-8             205536        7481 ns/op          484 B/op       8 allocs/op
+//BenchmarkTrie_PutParallel/Small_topk-8                254334        6879 ns/op          503 B/op       9 allocs/op
+//BenchmarkTrie_PutParallel/Medium_topk-8               265210        7059 ns/op          485 B/op       8 allocs/op
+//BenchmarkTrie_PutParallel/Large_topk-8                241968        7662 ns/op          473 B/op       8 allocs/op
+//BenchmarkTrie_IncParallel/Small_dataset-8             671284        2226 ns/op          322 B/op       6 allocs/op
+//BenchmarkTrie_IncParallel/Medium_dataset-8            372218        3435 ns/op          358 B/op       6 allocs/op
+//BenchmarkTrie_IncParallel/Large_dataset-8             215520        6234 ns/op          393 B/op       6 allocs/op
+//BenchmarkTrie_IncParallel/Small_topk-8                256585        6458 ns/op          438 B/op       8 allocs/op
+//BenchmarkTrie_IncParallel/Medium_topk-8               257553        6135 ns/op          413 B/op       7 allocs/op
+//BenchmarkTrie_IncParallel/Large_topk-8                194160        5887 ns/op          393 B/op       6 allocs/op
+//BenchmarkTrie_GetTopKAndInc/Small_dataset-8           821526        1758 ns/op          294 B/op       5 allocs/op
+//BenchmarkTrie_GetTopKAndInc/Medium_dataset-8          404283        4079 ns/op          356 B/op       5 allocs/op
+//BenchmarkTrie_GetTopKAndInc/Large_dataset-8           518908        5877 ns/op          450 B/op       5 allocs/op
+//BenchmarkTrie_GetTopKAndInc/Small_topk-8              740947        4069 ns/op          378 B/op       6 allocs/op
+//BenchmarkTrie_GetTopKAndInc/Medium_topk-8             748296        3890 ns/op          391 B/op       6 allocs/op
+//BenchmarkTrie_GetTopKAndInc/Large_topk-8              346932        6100 ns/op          453 B/op       6 allocs/op
+//BenchmarkTrie_GetTopKAndIncParallel/Small_dataset-8    632966        2430 ns/op          292 B/op       5 allocs/op
+//BenchmarkTrie_GetTopKAndIncParallel/Medium_dataset-8    331441        4674 ns/op          352 B/op       5 allocs/op
+//BenchmarkTrie_GetTopKAndIncParallel/Large_dataset-8    294663        6451 ns/op          448 B/op       5 allocs/op
+//BenchmarkTrie_GetTopKAndIncParallel/Small_topk-8      244180        5321 ns/op          374 B/op       6 allocs/op
+//BenchmarkTrie_GetTopKAndIncParallel/Medium_topk-8     303830        6266 ns/op          390 B/op       6 allocs/op
+//BenchmarkTrie_GetTopKAndIncParallel/Large_topk-8      234457        7148 ns/op          449 B/op       5 allocs/op
 
 // Benchmark for getTopK with different datasets
 func BenchmarkTrie_GetTopK(b *testing.B) {
@@ -413,6 +1183,42 @@ func BenchmarkTrie_Put(b *testing.B) {
 	}
 }
 
+func BenchmarkTrie_Apply(b *testing.B) {
+	tests := []struct {
+		name      string
+		topK      int
+		numKeys   int
+		batchSize int
+	}{
+		{name: "Small batch", topK: 10, numKeys: 100000, batchSize: 100},
+		{name: "Large batch", topK: 10, numKeys: 100000, batchSize: 10000},
+	}
+
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			b.ReportAllocs()
+			trie := NewTrie(tt.topK)
+
+			// Generate random keys and prepopulate the Trie
+			keys := generateRandomKeys(tt.numKeys)
+			for _, key := range keys {
+				trie.Put(key, 1) // Prepopulate with frequency 1
+			}
+
+			var batch Batch
+			b.ResetTimer() // Reset timer to exclude setup time
+			for i := 0; i < b.N; i++ {
+				batch.Add(keys[i%len(keys)], int64(i%100))
+				if batch.Len() == tt.batchSize {
+					trie.Apply(&batch)
+					batch.Reset()
+				}
+			}
+			trie.Apply(&batch)
+		})
+	}
+}
+
 func BenchmarkTrie_Inc(b *testing.B) {
 	tests := []struct {
 		name    string
@@ -426,6 +1232,8 @@ func BenchmarkTrie_Inc(b *testing.B) {
 		{name: "Small topk", topK: 5, numKeys: 100000},
 		{name: "Medium topk", topK: 10, numKeys: 100000},
 		{name: "Large topk", topK: 20, numKeys: 100000},
+		{name: "Browse topk", topK: 50, numKeys: 100000},
+		{name: "Huge topk", topK: 200, numKeys: 100000},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,582 @@
+package search_trie
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Durable tries live in a directory holding at most one snapshot and a
+// sequence of log segments:
+//
+//	snapshot-<seq>     WriteTo snapshot covering every segment before <seq>
+//	wal-<seq>.log      log segment, <seq> is a zero-padded decimal
+//
+// A segment is a sequence of records:
+//
+//	length  uint32, little-endian length of payload
+//	crc     uint32, little-endian CRC-32 (Castagnoli) of payload
+//	payload op byte, the time of the write if the op has bit 7 set, then
+//	        the op's arguments
+//
+// Times are signed varint Unix nanoseconds. Tries created WithDecay or
+// WithScorer log them on writes and replay them to restore decayed weights
+// and scores; a record may carry one whatever its op. Strings are a uvarint
+// byte length followed by the bytes, frequencies are uvarints and deltas
+// are signed varints. Ops:
+//
+//	1 put     key, frequency
+//	2 inc     key
+//	3 delete  key
+//	4 add     key, delta
+//	5 upsert  key, delta
+//
+// A torn record at the end of the newest segment is the result of a crash
+// mid-write and is discarded on Open.
+const (
+	opPut    = 1
+	opInc    = 2
+	opDelete = 3
+	opAdd    = 4
+	opUpsert = 5
+
+	opTimed = 1 << 7
+
+	snapshotPrefix = "snapshot-"
+	segmentPrefix  = "wal-"
+	segmentSuffix  = ".log"
+
+	defaultSegmentSize  = 64 << 20
+	defaultSyncInterval = time.Second
+)
+
+var (
+	// ErrCorruptLog is returned by Open when a log segment holds a damaged
+	// record that cannot be explained by a torn write at the end of the log.
+	ErrCorruptLog = errors.New("search_trie: corrupt log")
+	// ErrNotDurable is returned by Checkpoint on a Trie created by NewTrie.
+	ErrNotDurable = errors.New("search_trie: trie is not durable")
+	// ErrClosed is returned by Err and Checkpoint after Close. Later writes
+	// are applied in memory only and lost on restart.
+	ErrClosed = errors.New("search_trie: trie is closed")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// SyncPolicy controls when log writes are flushed to stable storage.
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs the log after every mutation.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval fsyncs the log in the background every SyncInterval.
+	SyncInterval
+	// SyncNever leaves flushing to the operating system. Writes still
+	// survive a crash of the process, but not of the machine.
+	SyncNever
+)
+
+// LogOptions configure the write-ahead log of a durable Trie.
+type LogOptions struct {
+	Sync SyncPolicy
+	// SyncInterval is the fsync period for SyncInterval, 1s by default.
+	SyncInterval time.Duration
+	// SegmentSize is the size after which a new segment is started,
+	// 64 MiB by default.
+	SegmentSize int64
+}
+
+type wal struct {
+	mu    sync.Mutex
+	ckpt  sync.Mutex // held by Checkpoint from the cut to the cleanup
+	dir   string
+	opts  LogOptions
+	seq   uint64
+	file  *os.File
+	size  int64
+	dirty bool
+	err   error
+	buf   []byte
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open opens the durable Trie stored in dir, creating it if needed. The
+// latest snapshot is loaded and the log replayed on top of it; every later
+// Put, Inc, Add, Upsert, Delete and Apply is appended to the log before it
+// is applied. A snapshot's topK limit and decay settings take precedence
+// over topK and trieOpts. Snapshots hold normalized keys, so a Trie created
+// WithNormalizer must be reopened with the same Normalizer.
+func Open(dir string, topK int, opts LogOptions, trieOpts ...Option) (*Trie, error) {
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = defaultSyncInterval
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	if err := removeTemp(dir); err != nil {
+		return nil, err
+	}
+	snapshots, segments, err := listDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	t := NewTrie(topK, trieOpts...)
+	// Readers see the Trie once it is loaded
+	t.lock()
+	defer t.unlock()
+	var start uint64
+	if len(snapshots) > 0 {
+		start = snapshots[len(snapshots)-1]
+		root, meta, err := loadSnapshot(filepath.Join(dir, snapshotName(start)))
+		if err != nil {
+			return nil, err
+		}
+		t.load(root, meta)
+	}
+
+	next := start
+	for i, seq := range segments {
+		if seq < start {
+			continue
+		}
+		if err := t.replaySegment(filepath.Join(dir, segmentName(seq)), i == len(segments)-1); err != nil {
+			return nil, err
+		}
+		next = seq + 1
+	}
+
+	l := &wal{dir: dir, opts: opts, seq: next, done: make(chan struct{})}
+	if err := l.openSegment(); err != nil {
+		return nil, err
+	}
+	if err := l.removeBefore(start); err != nil {
+		l.file.Close()
+		return nil, err
+	}
+	if opts.Sync == SyncInterval {
+		l.wg.Add(1)
+		go l.syncLoop()
+	}
+
+	t.log = l
+	return t, nil
+}
+
+// Checkpoint writes a snapshot of a durable Trie and truncates the log it
+// covers. The snapshot is taken as with Snapshot, so writers only wait
+// while the log moves on to a new segment, not while it is written.
+// Concurrent calls run one after another.
+func (t *Trie) Checkpoint() error {
+	if t.log == nil {
+		return ErrNotDurable
+	}
+
+	t.log.ckpt.Lock()
+	defer t.log.ckpt.Unlock()
+	t.mu.Lock()
+	v := t.freeze()
+	seq, err := t.log.cut()
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return t.log.checkpoint(seq, v.root, v.meta())
+}
+
+// Err returns the first error that occurred while appending to the log of
+// a durable Trie. Mutations are applied in memory even if logging fails.
+func (t *Trie) Err() error {
+	if t.log == nil {
+		return nil
+	}
+
+	t.log.mu.Lock()
+	defer t.log.mu.Unlock()
+	return t.log.err
+}
+
+// Close flushes and closes the log of a durable Trie. It is a no-op for
+// tries created by NewTrie.
+func (t *Trie) Close() error {
+	if t.log == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.log.close()
+}
+
+// logRecord appends a mutation to the log, if the Trie is durable. Deltas
+// are passed as their two's complement in value. A zero at is not logged.
+func (t *Trie) logRecord(op byte, key string, value uint64, at time.Time) {
+	if t.log != nil {
+		t.log.append(op, key, value, at)
+	}
+}
+
+func snapshotName(seq uint64) string {
+	return fmt.Sprintf("%s%016d", snapshotPrefix, seq)
+}
+
+func segmentName(seq uint64) string {
+	return fmt.Sprintf("%s%016d%s", segmentPrefix, seq, segmentSuffix)
+}
+
+// removeTemp removes the leftovers of checkpoints interrupted before the
+// Trie in dir was opened.
+func removeTemp(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasSuffix(name, ".tmp") {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// listDir returns the sequence numbers of the snapshots and segments in
+// dir in ascending order.
+func listDir(dir string) (snapshots, segments []uint64, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.HasSuffix(name, ".tmp"):
+		case strings.HasPrefix(name, snapshotPrefix):
+			if seq, err := strconv.ParseUint(strings.TrimPrefix(name, snapshotPrefix), 10, 64); err == nil {
+				snapshots = append(snapshots, seq)
+			}
+		case strings.HasPrefix(name, segmentPrefix) && strings.HasSuffix(name, segmentSuffix):
+			name = strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix)
+			if seq, err := strconv.ParseUint(name, 10, 64); err == nil {
+				segments = append(segments, seq)
+			}
+		}
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i] < snapshots[j] })
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return snapshots, segments, nil
+}
+
+func loadSnapshot(path string) (*node, snapshotMeta, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, snapshotMeta{}, err
+	}
+	defer f.Close()
+
+	root, meta, _, err := readNodeSnapshot(f)
+	if err != nil {
+		return nil, snapshotMeta{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return root, meta, nil
+}
+
+// errTornRecord marks a record cut short or garbled at the very end of a
+// segment, as left by a crash during append.
+var errTornRecord = errors.New("torn record")
+
+// replaySegment applies the records of a segment to the Trie. A torn record
+// at the end of the last segment is truncated away.
+func (t *Trie) replaySegment(path string, last bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	off := 0
+	for off < len(data) {
+		n, err := t.applyRecord(data[off:])
+		if err != nil {
+			if last && errors.Is(err, errTornRecord) {
+				return os.Truncate(path, int64(off))
+			}
+			return fmt.Errorf("%w: %s at byte %d: %v", ErrCorruptLog, path, off, err)
+		}
+		off += n
+	}
+	return nil
+}
+
+// applyRecord decodes the record at the start of data, applies it and
+// returns its encoded size. Writes are stamped with the time of the record,
+// or the current time for untimed records.
+func (t *Trie) applyRecord(data []byte) (int, error) {
+	if len(data) < 8 {
+		return 0, errTornRecord
+	}
+	size := int(binary.LittleEndian.Uint32(data))
+	sum := binary.LittleEndian.Uint32(data[4:])
+	if size > len(data)-8 {
+		return 0, errTornRecord
+	}
+	payload := data[8 : 8+size]
+	if crc32.Checksum(payload, castagnoli) != sum {
+		if 8+size == len(data) {
+			return 0, errTornRecord
+		}
+		return 0, errors.New("checksum mismatch")
+	}
+	if size == 0 {
+		return 0, errors.New("empty record")
+	}
+
+	op, payload := payload[0], payload[1:]
+	at := time.Now()
+	if op&opTimed != 0 {
+		ns, n := binary.Varint(payload)
+		if n <= 0 {
+			return 0, errors.New("bad time")
+		}
+		at, op, payload = time.Unix(0, ns), op&^opTimed, payload[n:]
+	}
+	s := t.stampAt(at)
+
+	keyLen, n := binary.Uvarint(payload)
+	if n <= 0 || keyLen > uint64(len(payload)-n) {
+		return 0, errors.New("bad key")
+	}
+	form := string(payload[n : n+int(keyLen)])
+	key := t.normalize(form)
+	payload = payload[n+int(keyLen):]
+
+	var value uint64
+	switch op {
+	case opPut:
+		if value, n = binary.Uvarint(payload); n <= 0 {
+			return 0, errors.New("bad frequency")
+		}
+		t.root.put(key, uint(value), nil, s)
+	case opInc:
+		t.root.inc(key, s)
+	case opDelete:
+		t.root.delete(key)
+	case opAdd, opUpsert:
+		delta, n := binary.Varint(payload)
+		if n <= 0 {
+			return 0, errors.New("bad delta")
+		}
+		value = uint64(delta)
+		t.root.add(key, delta, op == opUpsert, s)
+	default:
+		return 0, fmt.Errorf("unknown op %d", op)
+	}
+	t.written(key, form, op, value)
+	return 8 + size, nil
+}
+
+func (l *wal) openSegment() error {
+	f, err := os.OpenFile(filepath.Join(l.dir, segmentName(l.seq)), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	l.file, l.size = f, 0
+	return syncDir(l.dir)
+}
+
+// rotate closes the current segment and starts the next one.
+func (l *wal) rotate() error {
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.seq++
+	return l.openSegment()
+}
+
+func (l *wal) append(op byte, key string, value uint64, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return
+	}
+
+	buf := append(l.buf[:0], 0, 0, 0, 0, 0, 0, 0, 0, op)
+	if !at.IsZero() {
+		buf[8] |= opTimed
+		buf = binary.AppendVarint(buf, at.UnixNano())
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	switch op {
+	case opPut:
+		buf = binary.AppendUvarint(buf, value)
+	case opAdd, opUpsert:
+		buf = binary.AppendVarint(buf, int64(value))
+	}
+	binary.LittleEndian.PutUint32(buf, uint32(len(buf)-8))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.Checksum(buf[8:], castagnoli))
+	l.buf = buf
+
+	if _, err := l.file.Write(buf); err != nil {
+		l.err = err
+		return
+	}
+	l.size += int64(len(buf))
+	l.dirty = true
+
+	if l.opts.Sync == SyncAlways {
+		l.err = l.sync()
+	}
+	if l.err == nil && l.size >= l.opts.SegmentSize {
+		l.err = l.rotate()
+	}
+}
+
+func (l *wal) sync() error {
+	if !l.dirty {
+		return nil
+	}
+	l.dirty = false
+	return l.file.Sync()
+}
+
+func (l *wal) syncLoop() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(l.opts.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			if l.err == nil {
+				l.err = l.sync()
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// cut starts a new segment and returns its sequence number, the one of a
+// snapshot of the records logged so far.
+func (l *wal) cut() (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return 0, l.err
+	}
+
+	if err := l.rotate(); err != nil {
+		l.err = err
+		return 0, err
+	}
+	return l.seq, nil
+}
+
+// checkpoint writes the snapshot root of the records before segment seq
+// and removes the files it replaces.
+func (l *wal) checkpoint(seq uint64, root *node, meta snapshotMeta) error {
+	path := filepath.Join(l.dir, snapshotName(seq))
+	if err := writeSnapshot(root, meta, path); err != nil {
+		return err
+	}
+	if err := syncDir(l.dir); err != nil {
+		return err
+	}
+	return l.removeBefore(seq)
+}
+
+func writeSnapshot(root *node, meta snapshotMeta, path string) error {
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := root.writeTo(f, meta); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// removeBefore deletes the snapshots and segments older than seq.
+func (l *wal) removeBefore(seq uint64) error {
+	snapshots, segments, err := listDir(l.dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		if s < seq {
+			if err := os.Remove(filepath.Join(l.dir, snapshotName(s))); err != nil {
+				return err
+			}
+		}
+	}
+	for _, s := range segments {
+		if s < seq {
+			if err := os.Remove(filepath.Join(l.dir, segmentName(s))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *wal) close() error {
+	l.mu.Lock()
+	if l.err == ErrClosed {
+		l.mu.Unlock()
+		return nil
+	}
+	close(l.done)
+	l.mu.Unlock()
+	l.wg.Wait()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.err
+	if serr := l.sync(); err == nil {
+		err = serr
+	}
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.err = ErrClosed
+	return err
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
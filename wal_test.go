@@ -0,0 +1,248 @@
+package search_trie
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func expectKeys(t *testing.T, trie *Trie, expected map[string]uint) {
+	t.Helper()
+
+	output := make(map[string]uint)
+	for item := range trie.Traverse() {
+		output[item.Key] = item.Frequency
+	}
+	if len(output) != len(expected) {
+		t.Errorf("Traverse() = %v, want %v", output, expected)
+	}
+	for key, freq := range expected {
+		if got, ok := output[key]; !ok || got != freq {
+			t.Errorf("key %q has frequency %d, want %d", key, got, freq)
+		}
+	}
+}
+
+func TestOpen_Replay(t *testing.T) {
+	for _, policy := range []SyncPolicy{SyncAlways, SyncInterval, SyncNever} {
+		dir := t.TempDir()
+
+		trie, err := Open(dir, 5, LogOptions{Sync: policy, SegmentSize: 64})
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		trie.Put("iphone", 30)
+		trie.Put("ipad", 35)
+		trie.Inc("iphone")
+		trie.Put("айфон", 1)
+		trie.Delete("ipad")
+		trie.Add("iphone", -11)
+		trie.Upsert("macbook", 4)
+		if err := trie.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+
+		trie, err = Open(dir, 5, LogOptions{Sync: policy})
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		expectKeys(t, trie, map[string]uint{"iphone": 20, "айфон": 1, "macbook": 4})
+		if err := trie.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+}
+
+func TestOpen_Checkpoint(t *testing.T) {
+	dir := t.TempDir()
+
+	trie, err := Open(dir, 5, LogOptions{SegmentSize: 32})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	trie.Put("macbook", 4)
+	trie.Put("macbook pro", 8)
+	if err := trie.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint() error = %v", err)
+	}
+	trie.Inc("macbook")
+	trie.Put("макбук", 2)
+	if err := trie.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// The checkpoint leaves one snapshot and only the segments after it
+	snapshots, segments, err := listDir(dir)
+	if err != nil {
+		t.Fatalf("listDir() error = %v", err)
+	}
+	if len(snapshots) != 1 {
+		t.Fatalf("found %d snapshots, want 1", len(snapshots))
+	}
+	for _, seq := range segments {
+		if seq < snapshots[0] {
+			t.Errorf("segment %d was not truncated by snapshot %d", seq, snapshots[0])
+		}
+	}
+
+	trie, err = Open(dir, 5, LogOptions{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer trie.Close()
+	expectKeys(t, trie, map[string]uint{"macbook": 5, "macbook pro": 8, "макбук": 2})
+}
+
+func TestOpen_TornTail(t *testing.T) {
+	dir := t.TempDir()
+
+	trie, err := Open(dir, 5, LogOptions{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	trie.Put("iphone", 30)
+	trie.Put("ipad", 35)
+	trie.Close()
+
+	// Simulate a crash in the middle of appending a record
+	_, segments, _ := listDir(dir)
+	path := filepath.Join(dir, segmentName(segments[len(segments)-1]))
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, data[:len(data)-3], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	trie, err = Open(dir, 5, LogOptions{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	expectKeys(t, trie, map[string]uint{"iphone": 30})
+	trie.Put("macbook", 4)
+	trie.Close()
+
+	// The torn record was truncated, so the old segment now replays cleanly
+	trie, err = Open(dir, 5, LogOptions{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer trie.Close()
+	expectKeys(t, trie, map[string]uint{"iphone": 30, "macbook": 4})
+}
+
+func TestOpen_CorruptSegment(t *testing.T) {
+	dir := t.TempDir()
+
+	trie, err := Open(dir, 5, LogOptions{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	trie.Put("iphone", 30)
+	trie.Put("ipad", 35)
+	trie.Close()
+
+	_, segments, _ := listDir(dir)
+	path := filepath.Join(dir, segmentName(segments[0]))
+	data, _ := os.ReadFile(path)
+	data[10] ^= 0xff // Damage the first of two records
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(dir, 5, LogOptions{}); !errors.Is(err, ErrCorruptLog) {
+		t.Errorf("Open() error = %v, want ErrCorruptLog", err)
+	}
+}
+
+func TestTrie_CheckpointNotDurable(t *testing.T) {
+	if err := NewTrie(5).Checkpoint(); !errors.Is(err, ErrNotDurable) {
+		t.Errorf("Checkpoint() error = %v, want ErrNotDurable", err)
+	}
+}
+
+func TestOpen_CheckpointConcurrent(t *testing.T) {
+	dir := t.TempDir()
+
+	trie, err := Open(dir, 5, LogOptions{SegmentSize: 256})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			trie.Upsert("iphone", 1)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if err := trie.Checkpoint(); err != nil {
+			t.Fatalf("Checkpoint() error = %v", err)
+		}
+	}
+	<-done
+	if err := trie.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Every write is in a snapshot or in a segment after it
+	trie, err = Open(dir, 5, LogOptions{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer trie.Close()
+	expectKeys(t, trie, map[string]uint{"iphone": 500})
+}
+
+func TestOpen_CheckpointParallel(t *testing.T) {
+	dir := t.TempDir()
+
+	trie, err := Open(dir, 5, LogOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	expected := map[string]uint{}
+	for i := 0; i < 5000; i++ {
+		key := fmt.Sprintf("iphone %d", i)
+		trie.Put(key, uint(i))
+		expected[key] = uint(i)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*10)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				errs <- trie.Checkpoint()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Checkpoint() error = %v", err)
+		}
+	}
+	if err := trie.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Open sweeps the leftovers of an interrupted checkpoint
+	tmp := filepath.Join(dir, snapshotName(1<<40)+".tmp")
+	if err := os.WriteFile(tmp, []byte("torn"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	trie, err = Open(dir, 5, LogOptions{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer trie.Close()
+	expectKeys(t, trie, expected)
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("Open() left %s behind", tmp)
+	}
+}